@@ -0,0 +1,151 @@
+package opc
+
+import (
+	"archive/zip"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// appender keeps the state of a Writer appending to an existing package.
+type appender struct {
+	*zipAppender
+	existing *Reader
+	props    CoreProperties
+	rels     []Relationship
+	partRels map[*File][]Relationship
+}
+
+// NewAppendWriter returns a Writer which adds new parts to the existing package stored in f, of the given size.
+// The new parts are written after the data of the existing ones, which is never rewritten,
+// so appending costs time proportional to the new data only.
+// On Close the [Content_Types].xml stream, the core properties and the relationship parts that have changed
+// are written as new items, and a new central directory replaces the old one.
+// If Close fails or Abort is called f is restored to its original content.
+// The new data overwrites the old central directory, so if the process stops before Close finishes,
+// f is left without a central directory and cannot be opened. Keep a copy of it if that cannot be risked.
+//
+// The existing parts are returned by Existing and their names cannot be reused.
+// The Properties and Relationships fields are initialized from the existing package.
+func NewAppendWriter(f AppendFile, size int64) (*Writer, error) {
+	r, err := NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	za, err := newZipAppender(f, size)
+	if err != nil {
+		return nil, err
+	}
+	props := r.Properties
+	for _, rel := range r.Relationships {
+		if strings.EqualFold(rel.Type, corePropsRel) {
+			// Keep the existing name when rewriting the core properties
+			if props.PartName, err = rel.AbsoluteTarget("/"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	app := &appender{zipAppender: za, existing: r, props: props, rels: copyRelationships(r.Relationships), partRels: make(map[*File][]Relationship)}
+	for _, file := range r.Files {
+		app.partRels[file] = copyRelationships(file.Relationships)
+	}
+	zw := zip.NewWriter(za)
+	zw.SetOffset(za.dir.offset)
+	// Not seeded as NewWriter, which would generate the same identifiers as the writer of the package
+	w := &Writer{p: appendPackage(r, props.PartName), w: zw, rnd: rand.New(rand.NewSource(size)), app: app}
+	w.Properties = props
+	w.Relationships = r.Relationships
+	return w, nil
+}
+
+// OpenAppendWriter opens the OPC file specified by name and returns a Writer appending to it, see NewAppendWriter.
+// The file is closed when the Writer is closed or aborted.
+func OpenAppendWriter(name string) (*Writer, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w, err := NewAppendWriter(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.app.closer = f
+	return w, nil
+}
+
+// Existing returns the package being appended to, or nil if the Writer is not appending.
+// The Relationships of its Files can be modified until the Writer is closed,
+// the relationship parts that have changed are rewritten.
+func (w *Writer) Existing() *Reader {
+	if w.app == nil {
+		return nil
+	}
+	return w.app.existing
+}
+
+// appendPackage returns a package with the parts and the content types of r,
+// whose overrides are keyed by the part names found in the package as the Writer does, instead of by canonical name.
+// The core properties override uses coreProps, the name used by the Writer when rewriting it.
+func appendPackage(r *Reader, coreProps string) *pkg {
+	p := newPackage()
+	for name, part := range r.p.parts {
+		p.parts[name] = part
+	}
+	for ext, ct := range r.p.contentTypes.defaults {
+		p.contentTypes.addDefault(ext, ct)
+	}
+	for name, ct := range r.p.contentTypes.overrides {
+		if coreProps != "" && PartNamesEquivalent(name, coreProps) {
+			name = coreProps
+		} else if original, ok := r.p.contentTypes.names[name]; ok {
+			name = original
+		}
+		p.contentTypes.addOverride(name, ct)
+	}
+	return p
+}
+
+// createExistingRelationships writes the relationship parts of the existing parts that have changed.
+func (w *Writer) createExistingRelationships() error {
+	if w.app == nil {
+		return nil
+	}
+	for _, file := range w.app.existing.Files {
+		if !relationshipsChanged(file.Relationships, w.app.partRels[file]) {
+			continue
+		}
+		w.app.remove(relationshipsPartName(file.Name))
+		if err := w.createPartRelationships(file.Name, file.Relationships); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyRelationships(rels []*Relationship) []Relationship {
+	cp := make([]Relationship, len(rels))
+	for i, r := range rels {
+		cp[i] = *r
+	}
+	return cp
+}
+
+// relationshipsChanged returns true if rels is not equal to the snapshot old.
+func relationshipsChanged(rels []*Relationship, old []Relationship) bool {
+	if len(rels) != len(old) {
+		return true
+	}
+	for i, r := range rels {
+		if *r != old[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// appendTestPackage has core properties, package and part relationships, and two parts.
+var appendTestPackage = map[string]string{
+	"[Content_Types].xml": new(cTypeBuilder).withDefault("application/xml", "xml").
+		withDefault("application/vnd.openxmlformats-package.relationships+xml", "rels").
+		withOverride(corePropsContentType, "/docProps/core.xml").String(),
+	"_rels/.rels":           new(relsBuilder).withRel("rId1", "doc", "docs/a.xml").withRel("rId2", corePropsRel, "docProps/core.xml").String(),
+	"docProps/core.xml":     buildCoreString("<dc:title>t</dc:title>"),
+	"docs/a.xml":            "<a/>",
+	"docs/_rels/a.xml.rels": new(relsBuilder).withRelMode("rId1", "ext", "http://example.com", "External").String(),
+	"docs/b.xml":            "<b/>",
+}
+
+// writeAppendTestFile writes the package built from files to a temporary file and returns its name.
+func writeAppendTestFile(t *testing.T, files map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "a.docx")
+	if err := ioutil.WriteFile(name, buildPackage(t, files), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func zipItemNames(t *testing.T, b []byte) map[string]int {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	names := make(map[string]int)
+	for _, f := range zr.File {
+		names[f.Name]++
+	}
+	return names
+}
+
+func TestOpenAppendWriter(t *testing.T) {
+	name := writeAppendTestFile(t, appendTestPackage)
+	original, _ := ioutil.ReadFile(name)
+	dir, err := readZipDirectory(bytes.NewReader(original), int64(len(original)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := OpenAppendWriter(name)
+	if err != nil {
+		t.Fatalf("OpenAppendWriter() error = %v", err)
+	}
+	if w.Properties.Title != "t" || len(w.Relationships) != 2 {
+		t.Errorf("OpenAppendWriter() Properties = %v, Relationships = %v", w.Properties, w.Relationships)
+	}
+	if _, err = w.Create("/docs/a.xml", "application/xml"); err == nil {
+		t.Error("Writer.Create() want error for an existing part")
+	}
+	if _, err = w.Create("/docs/b.xml/c.xml", "application/xml"); err == nil {
+		t.Error("Writer.Create() want error for a part derived from an existing part")
+	}
+	pw, err := w.Create("/docs/c.xml", "text/xml")
+	if err != nil {
+		t.Fatalf("Writer.Create() error = %v", err)
+	}
+	pw.Write([]byte("<c/>"))
+	b, _ := w.Existing().File("/docs/b.xml")
+	b.Relationships = append(b.Relationships, &Relationship{ID: "rId1", Type: "next", TargetURI: "c.xml", TargetMode: ModeInternal})
+	if err = w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+
+	got, _ := ioutil.ReadFile(name)
+	if !bytes.Equal(got[:dir.offset], original[:dir.offset]) {
+		t.Error("Writer.Close() rewrote the existing items")
+	}
+	for item, n := range zipItemNames(t, got) {
+		if n != 1 {
+			t.Errorf("item %s found %d times", item, n)
+		}
+	}
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer r.Close()
+	if len(r.Files) != 3 || r.Properties.Title != "t" || len(r.Relationships) != 2 {
+		t.Fatalf("OpenReader() = %v, %v, %v", fileNames(r.Files), r.Properties, r.Relationships)
+	}
+	if f, ok := r.File("/docs/c.xml"); !ok || f.ContentType != "text/xml" {
+		t.Errorf("Reader.File(/docs/c.xml) = %v, %v", f, ok)
+	} else if rc, err := f.Open(); err != nil {
+		t.Errorf("File.Open() error = %v", err)
+	} else if c, _ := ioutil.ReadAll(rc); string(c) != "<c/>" {
+		t.Errorf("File.Open() content = %s, want <c/>", c)
+	}
+	if f, _ := r.File("/docs/a.xml"); len(f.Relationships) != 1 || f.Relationships[0].TargetMode != ModeExternal {
+		t.Errorf("File(/docs/a.xml).Relationships = %v", f.Relationships)
+	}
+	if f, _ := r.File("/docs/b.xml"); len(f.Relationships) != 1 || f.Relationships[0].TargetURI != "c.xml" {
+		t.Errorf("File(/docs/b.xml).Relationships = %v", f.Relationships)
+	}
+}
+
+func TestOpenAppendWriter_properties(t *testing.T) {
+	name := writeAppendTestFile(t, appendTestPackage)
+	for _, title := range []string{"u", "v"} {
+		w, err := OpenAppendWriter(name)
+		if err != nil {
+			t.Fatalf("OpenAppendWriter() error = %v", err)
+		}
+		w.Properties.Title = title
+		w.Existing().Files[0].Relationships = nil
+		if err = w.Close(); err != nil {
+			t.Fatalf("Writer.Close() error = %v", err)
+		}
+	}
+	b, _ := ioutil.ReadFile(name)
+	for item, n := range zipItemNames(t, b) {
+		if n != 1 {
+			t.Errorf("item %s found %d times", item, n)
+		}
+	}
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer r.Close()
+	if r.Properties.Title != "v" || len(r.Relationships) != 2 {
+		t.Errorf("OpenReader() Properties = %v, Relationships = %v", r.Properties, r.Relationships)
+	}
+	if f, _ := r.File("/docs/a.xml"); len(f.Relationships) != 0 {
+		t.Errorf("File(/docs/a.xml).Relationships = %v, want none", f.Relationships)
+	}
+}
+
+func TestOpenAppendWriter_failure(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish func(w *Writer) error
+	}{
+		{"abort", func(w *Writer) error {
+			if err := w.Abort(); err != nil {
+				t.Fatalf("Writer.Abort() error = %v", err)
+			}
+			return w.Close()
+		}},
+		{"closeError", func(w *Writer) error {
+			w.Relationships = append(w.Relationships, &Relationship{ID: "rId1", Type: "a", TargetURI: "b.xml"})
+			return w.Close()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := writeAppendTestFile(t, appendTestPackage)
+			original, _ := ioutil.ReadFile(name)
+			w, err := OpenAppendWriter(name)
+			if err != nil {
+				t.Fatalf("OpenAppendWriter() error = %v", err)
+			}
+			pw, _ := w.Create("/docs/c.xml", "application/xml")
+			pw.Write(bytes.Repeat([]byte("c"), 10000))
+			if err = tt.finish(w); err == nil {
+				t.Error("Writer.Close() want error")
+			}
+			if got, _ := ioutil.ReadFile(name); !bytes.Equal(got, original) {
+				t.Error("the package has not been restored")
+			}
+		})
+	}
+}
+
+func TestOpenAppendWriter_overrideNames(t *testing.T) {
+	ct := new(cTypeBuilder).withDefault("application/xml", "xml").withOverride("a/b", "/Docs/A.bin").withOverride("c/d", "/docs/missing.bin").String()
+	name := writeAppendTestFile(t, map[string]string{"[Content_Types].xml": ct, "docs/a.bin": "a"})
+	w, err := OpenAppendWriter(name)
+	if err != nil {
+		t.Fatalf("OpenAppendWriter() error = %v", err)
+	}
+	pw, _ := w.Create("/docs/b.xml", "application/xml")
+	pw.Write([]byte("<b/>"))
+	if err = w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	defer r.Close()
+	for _, s := range []string{`PartName="/Docs/A.bin"`, `PartName="/docs/missing.bin"`} {
+		if !strings.Contains(string(readZipItem(t, r, contentTypesName[1:])), s) {
+			t.Errorf("[Content_Types].xml does not contain %s", s)
+		}
+	}
+}
+
+func TestWriter_Existing(t *testing.T) {
+	if r := NewWriter(new(bytes.Buffer)).Existing(); r != nil {
+		t.Errorf("Writer.Existing() = %v, want nil", r)
+	}
+}
+
+func Test_writeZipDirectory_zip64(t *testing.T) {
+	b := buildPackage(t, map[string]string{"a.xml": "<a/>", "b.xml": "<b/>"})
+	dir, err := readZipDirectory(bytes.NewReader(b), int64(len(b)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := splitZipDirectory(b[dir.offset : dir.offset+dir.size])
+	if err != nil || len(records) != 2 {
+		t.Fatalf("splitZipDirectory() = %v, %v", records, err)
+	}
+	var buf bytes.Buffer
+	const offset = 1 << 32
+	if err = writeZipDirectory(&buf, [][]byte{records[0].raw, records[1].raw}, offset); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readZipDirectory(bytes.NewReader(buf.Bytes()), int64(buf.Len()), offset)
+	if err != nil {
+		t.Fatalf("readZipDirectory() error = %v", err)
+	}
+	if want := (zipDirectory{offset: 0, size: dir.size, records: 2}); got != want {
+		t.Errorf("readZipDirectory() = %v, want %v", got, want)
+	}
+}
+
+func readZipItem(t *testing.T, r *ReadCloser, name string) []byte {
+	t.Helper()
+	for _, f := range r.r.Files() {
+		if f.Name() == name {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, _ := ioutil.ReadAll(rc)
+			return b
+		}
+	}
+	t.Fatalf("item %s not found", name)
+	return nil
+}
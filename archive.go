@@ -0,0 +1,42 @@
+package opc
+
+import "io"
+
+// Archive is the physical package format from which a Reader reads the parts.
+// NewReader uses a ZIP archive, other physical mappings can be used with NewReaderFromArchive.
+type Archive interface {
+	// Files returns the items of the archive, including the [Content_Types].xml stream
+	// and the relationship parts.
+	Files() []ArchiveFile
+}
+
+// ArchiveFile is an item of an Archive.
+// If it implements OpenSeeker() (ReadSeekerAt, error) it will be used by File.OpenSeeker,
+// and if it implements ModTime() time.Time it will be reported by the fs.FileInfo of the part.
+type ArchiveFile interface {
+	// Open returns a ReadCloser that provides access to the item contents.
+	// It is called concurrently when the Reader uses LoadParallel.
+	Open() (io.ReadCloser, error)
+	// Name returns the name of the item, which is the part name without the leading slash and encoded as an IRI,
+	// such as "word/document.xml". Names ending in a slash are folders and are ignored.
+	Name() string
+	// Size returns the uncompressed size of the item.
+	Size() int
+}
+
+// ArchiveWriter is the physical package format to which a Writer writes the parts.
+// NewWriter uses a ZIP archive, other physical mappings can be used with NewWriterToArchive.
+// If it implements Flush() error it will be called by Writer.Flush,
+// and if it implements Abort() error it will be called by Writer.Abort.
+type ArchiveWriter interface {
+	// Create adds an item to the archive using the provided name, with the same format as ArchiveFile.Name.
+	// The item contents must be written to the io.Writer before the next call to Create or Close.
+	Create(name string) (io.Writer, error)
+	// Close finishes writing the archive.
+	Close() error
+}
+
+// decompressorRegisterer is implemented by the archives that support custom decompressors.
+type decompressorRegisterer interface {
+	RegisterDecompressor(method uint16, dcomp func(r io.Reader) io.ReadCloser)
+}
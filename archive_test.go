@@ -0,0 +1,110 @@
+package opc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// memArchive is an in-memory Archive and ArchiveWriter.
+type memArchive struct {
+	names   []string
+	items   map[string]*bytes.Buffer
+	closed  bool
+	flushed int
+}
+
+func newMemArchive() *memArchive {
+	return &memArchive{items: make(map[string]*bytes.Buffer)}
+}
+
+func (m *memArchive) Create(name string) (io.Writer, error) {
+	if m.closed {
+		return nil, errors.New("closed")
+	}
+	m.names = append(m.names, name)
+	m.items[name] = new(bytes.Buffer)
+	return m.items[name], nil
+}
+
+func (m *memArchive) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *memArchive) Flush() error {
+	m.flushed++
+	return nil
+}
+
+func (m *memArchive) Files() []ArchiveFile {
+	files := make([]ArchiveFile, len(m.names))
+	for i, name := range m.names {
+		files[i] = memFile{name, m.items[name].Bytes()}
+	}
+	return files
+}
+
+type memFile struct {
+	name string
+	b    []byte
+}
+
+func (f memFile) Open() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(f.b)), nil }
+func (f memFile) Name() string                 { return f.name }
+func (f memFile) Size() int                    { return len(f.b) }
+
+func TestArchive_roundTrip(t *testing.T) {
+	a := newMemArchive()
+	w := NewWriterToArchive(a)
+	if err := w.SetParallelCompression(4, 0); err == nil {
+		t.Error("Writer.SetParallelCompression() want error for non ZIP archives")
+	}
+	w.Properties.Title = "Song"
+	w.Relationships = []*Relationship{{ID: "rId1", Type: "a", TargetURI: "/docs/a.xml"}}
+	pw, err := w.CreatePart(&Part{Name: "/docs/a.xml", ContentType: "application/xml", Relationships: []*Relationship{{ID: "rId1", Type: "b", TargetURI: "b.png"}}}, CompressionMaximum)
+	if err != nil {
+		t.Fatalf("Writer.CreatePart() error = %v", err)
+	}
+	pw.Write([]byte("<a/>"))
+	if _, err := w.Create("/docs/b.png", "image/png"); err != nil {
+		t.Fatalf("Writer.Create() error = %v", err)
+	}
+	if _, err := w.Create("/DOCS/B.PNG", "image/png"); err == nil {
+		t.Error("Writer.Create() want error for equivalent part names")
+	}
+	if err := w.Flush(); err != nil || a.flushed != 1 {
+		t.Errorf("Writer.Flush() error = %v, flushed = %d", err, a.flushed)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if !a.closed {
+		t.Error("Writer.Close() should close the archive")
+	}
+	r, err := NewReaderFromArchive(a, ReaderOptions{})
+	if err != nil {
+		t.Fatalf("NewReaderFromArchive() error = %v", err)
+	}
+	r.SetDecompressor(nil)
+	if len(r.Files) != 2 || r.Properties.Title != "Song" || len(r.Relationships) != 2 {
+		t.Fatalf("NewReaderFromArchive() files = %d, properties = %v, relationships = %d", len(r.Files), r.Properties, len(r.Relationships))
+	}
+	if r.Files[0].Name != "/docs/a.xml" || r.Files[0].ContentType != "application/xml" || len(r.Files[0].Relationships) != 1 {
+		t.Errorf("NewReaderFromArchive() part = %v", r.Files[0].Part)
+	}
+	rc, _ := r.Files[0].Open()
+	if b, _ := ioutil.ReadAll(rc); string(b) != "<a/>" {
+		t.Errorf("File.Open() content = %s, want <a/>", b)
+	}
+}
+
+func TestNewReaderFromArchive_validation(t *testing.T) {
+	a := newMemArchive()
+	pw, _ := a.Create("a.xml")
+	pw.Write([]byte("<a/>"))
+	_, err := NewReaderFromArchive(a, ReaderOptions{})
+	checkErrorCode(t, "NewReaderFromArchive()", err, 310)
+}
@@ -0,0 +1,54 @@
+package opc
+
+import (
+	"path"
+	"strings"
+)
+
+// CompressionPolicy returns the compression option of a part given its name and content type.
+type CompressionPolicy func(name, contentType string) CompressionOption
+
+// storedContentTypes contains the content types of data that is already compressed.
+var storedContentTypes = map[string]struct{}{
+	"image/jpeg":                   {},
+	"image/png":                    {},
+	"image/gif":                    {},
+	"image/webp":                   {},
+	"application/zip":              {},
+	"application/x-zip-compressed": {},
+	"application/gzip":             {},
+	"application/x-7z-compressed":  {},
+}
+
+// storedExtensions contains the extensions of files that are already compressed.
+var storedExtensions = map[string]struct{}{
+	".jpg":  {},
+	".jpeg": {},
+	".png":  {},
+	".gif":  {},
+	".webp": {},
+	".zip":  {},
+	".gz":   {},
+	".7z":   {},
+	".mp3":  {},
+	".mp4":  {},
+	".docx": {},
+	".xlsx": {},
+	".pptx": {},
+}
+
+// DefaultCompressionPolicy stores without compression the parts whose content is already compressed,
+// such as JPEG and PNG images, audio, video and nested ZIP packages, and compresses the rest using CompressionNormal.
+func DefaultCompressionPolicy(name, contentType string) CompressionOption {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if _, ok := storedContentTypes[mediaType]; ok {
+		return CompressionNone
+	}
+	if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") || strings.HasSuffix(mediaType, "+zip") {
+		return CompressionNone
+	}
+	if _, ok := storedExtensions[strings.ToLower(path.Ext(name))]; ok {
+		return CompressionNone
+	}
+	return CompressionNormal
+}
@@ -0,0 +1,28 @@
+package opc
+
+import "testing"
+
+func TestDefaultCompressionPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		partName    string
+		contentType string
+		want        CompressionOption
+	}{
+		{"xml", "/a.xml", "application/xml", CompressionNormal},
+		{"jpeg", "/a", "image/jpeg", CompressionNone},
+		{"pngParams", "/a", "IMAGE/PNG; a=b", CompressionNone},
+		{"video", "/a", "video/mp4", CompressionNone},
+		{"zipSuffix", "/a", "application/epub+zip", CompressionNone},
+		{"extension", "/a.JPG", "application/octet-stream", CompressionNone},
+		{"nestedPackage", "/embeddings/a.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", CompressionNone},
+		{"binary", "/a.bin", "application/octet-stream", CompressionNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultCompressionPolicy(tt.partName, tt.contentType); got != tt.want {
+				t.Errorf("DefaultCompressionPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
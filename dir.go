@@ -0,0 +1,172 @@
+package opc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OpenDirReader returns a Reader reading the OPC package stored as an unzipped folder in dir,
+// which shall contain the [Content_Types].xml stream and the parts as files,
+// using the same name mapping as the ZIP items.
+// Symbolic links are ignored, so the package cannot reference files outside dir.
+func OpenDirReader(dir string) (*Reader, error) {
+	a, err := newDirArchive(dir)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(a)
+}
+
+// NewDirWriter returns a new Writer writing an OPC package as an unzipped folder in dir,
+// with a file for each part using the same name mapping as the ZIP items.
+// The folder is created if it does not exist and existing files are overwritten.
+// Symbolic links inside dir are never followed, writing through them fails,
+// so the package cannot be written outside dir.
+// Writer.Abort does not remove the files already written.
+func NewDirWriter(dir string) *Writer {
+	return NewWriterToArchive(&dirArchiveWriter{root: dir})
+}
+
+// dirPath returns the path of an archive item inside root.
+// It fails if the name is not a relative path which stays inside root.
+func dirPath(root, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("opc: %s: invalid file path", name)
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." || filepath.VolumeName(seg) != "" {
+			return "", fmt.Errorf("opc: %s: invalid file path", name)
+		}
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+type dirArchive struct {
+	files []ArchiveFile
+}
+
+func newDirArchive(root string) (*dirArchive, error) {
+	// filepath.Walk does not follow the root if it is a symbolic link
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	a := new(dirArchive)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		a.files = append(a.files, &dirFile{path: path, name: filepath.ToSlash(rel), size: int(info.Size()), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *dirArchive) Files() []ArchiveFile {
+	return a.files
+}
+
+type dirFile struct {
+	path    string
+	name    string
+	size    int
+	modTime time.Time
+}
+
+func (f *dirFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+func (f *dirFile) Name() string {
+	return f.name
+}
+
+func (f *dirFile) Size() int {
+	return f.size
+}
+
+func (f *dirFile) ModTime() time.Time {
+	return f.modTime
+}
+
+type dirArchiveWriter struct {
+	root string
+	last *os.File
+}
+
+func (w *dirArchiveWriter) Create(name string) (io.Writer, error) {
+	if err := w.closeLast(); err != nil {
+		return nil, err
+	}
+	path, err := dirPath(w.root, name)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(w.root, 0755); err != nil {
+		return nil, err
+	}
+	if err = mkdirNoSymlinks(w.root, filepath.Dir(filepath.FromSlash(name))); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(path); err == nil && !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("opc: %s: cannot be created: %s exists and is not a regular file", name, path)
+	}
+	if w.last, err = os.Create(path); err != nil {
+		return nil, err
+	}
+	return w.last, nil
+}
+
+func (w *dirArchiveWriter) closeLast() error {
+	if w.last == nil {
+		return nil
+	}
+	err := w.last.Close()
+	w.last = nil
+	return err
+}
+
+func (w *dirArchiveWriter) Close() error {
+	return w.closeLast()
+}
+
+// mkdirNoSymlinks creates the folder rel inside root, failing if any of its components is not a folder,
+// which includes symbolic links, so the files cannot be written outside root.
+func mkdirNoSymlinks(root, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	p := root
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, seg)
+		fi, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			if err = os.Mkdir(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("opc: %s: not a folder", p)
+		}
+	}
+	return nil
+}
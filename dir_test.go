@@ -0,0 +1,157 @@
+package opc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// copyPackage writes all the parts of r into w.
+func copyPackage(t *testing.T, r *Reader, w *Writer) {
+	t.Helper()
+	w.Properties = r.Properties
+	// The core properties relationship is created by the Writer
+	for _, rel := range r.Relationships {
+		if rel.Type != corePropsRel {
+			w.Relationships = append(w.Relationships, rel)
+		}
+	}
+	for _, f := range r.Files {
+		pw, err := w.CreatePart(&Part{Name: f.Name, ContentType: f.ContentType, Relationships: f.Relationships}, CompressionNormal)
+		if err != nil {
+			t.Fatalf("Writer.CreatePart() error = %v", err)
+		}
+		rc, _ := f.Open()
+		io.Copy(pw, rc)
+		rc.Close()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+}
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			b, _ := ioutil.ReadFile(path)
+			rel, _ := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = string(b)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestDir_roundTrip(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	writeSamplePackage(t, NewDirWriter(dir1))
+	files := readDir(t, dir1)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "docs/_rels/a.xml.rels", "docs/media/b.png", "docs/été.xml", "props/core.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("NewDirWriter() missing file %s, got %v", name, files)
+		}
+	}
+
+	// Pack the folder into a ZIP package and unpack it into another folder
+	r, err := OpenDirReader(dir1)
+	if err != nil {
+		t.Fatalf("OpenDirReader() error = %v", err)
+	}
+	buf := new(bytes.Buffer)
+	copyPackage(t, r, NewWriter(buf))
+	zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	copyPackage(t, zr, NewDirWriter(dir2))
+	if got := readDir(t, dir2); !reflect.DeepEqual(got, files) {
+		t.Errorf("round trip = %v, want %v", got, files)
+	}
+}
+
+func TestOpenDirReader(t *testing.T) {
+	if _, err := OpenDirReader(filepath.Join(t.TempDir(), "notexists")); err == nil {
+		t.Error("OpenDirReader() want error for a missing folder")
+	}
+	dir, outside := t.TempDir(), t.TempDir()
+	writeSamplePackage(t, NewDirWriter(dir))
+	ioutil.WriteFile(filepath.Join(outside, "secret.xml"), []byte("secret"), 0644)
+	if err := os.Symlink(filepath.Join(outside, "secret.xml"), filepath.Join(dir, "docs", "link.xml")); err != nil {
+		t.Skip("symbolic links not supported")
+	}
+	r, err := OpenDirReader(dir)
+	if err != nil {
+		t.Fatalf("OpenDirReader() error = %v", err)
+	}
+	for _, f := range r.Files {
+		if f.Name == "/docs/link.xml" {
+			t.Error("OpenDirReader() should ignore symbolic links")
+		}
+	}
+	// The root itself can be a symbolic link
+	root := filepath.Join(outside, "root")
+	if err := os.Symlink(dir, root); err != nil {
+		t.Fatal(err)
+	}
+	if r2, err := OpenDirReader(root); err != nil || len(r2.Files) != len(r.Files) {
+		t.Errorf("OpenDirReader() with a symbolic link root = %v, %v, want %d files", r2, err, len(r.Files))
+	}
+}
+
+func TestNewDirWriter_symlinks(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	target := filepath.Join(outside, "a.xml")
+	ioutil.WriteFile(target, []byte("outside"), 0644)
+	if err := os.Symlink(outside, filepath.Join(dir, "docs")); err != nil {
+		t.Skip("symbolic links not supported")
+	}
+	os.Symlink(target, filepath.Join(dir, "b.xml"))
+	for _, name := range []string{"/docs/c.xml", "/b.xml"} {
+		w := NewDirWriter(dir)
+		if _, err := w.Create(name, "application/xml"); err == nil {
+			t.Errorf("Writer.Create(%s) want error for a path through a symbolic link", name)
+		}
+	}
+	if b, _ := ioutil.ReadFile(target); string(b) != "outside" {
+		t.Errorf("file outside the root = %s, want outside", b)
+	}
+	if names := dirNames(t, outside); len(names) != 1 {
+		t.Errorf("files outside the root = %v, want only a.xml", names)
+	}
+}
+
+func Test_dirPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"a/b.xml", filepath.Join("root", "a", "b.xml"), false},
+		{"[Content_Types].xml", filepath.Join("root", "[Content_Types].xml"), false},
+		{"", "", true},
+		{"/a.xml", "", true},
+		{"../a.xml", "", true},
+		{"a/../../b.xml", "", true},
+		{"a/./b.xml", "", true},
+		{"a//b.xml", "", true},
+		{"a\\..\\..\\b.xml", "", true},
+		{"a\x00.xml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dirPath("root", tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dirPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("dirPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,15 +19,29 @@ var errorsString = map[int]string{
 	112: "a package shall not contain equivalent part names",
 	113: "a part content type shall fit the definition and syntax for media types as specified in RFC 2616 §3.7",
 	114: "a part content type shall not have linear, leading or trailing white space",
+	117: "XML content shall be encoded using either UTF-8 or UTF-16",
+	118: "XML content shall not contain DTD declarations",
+	120: "XML content shall be valid against the corresponding XSD schema",
 	125: "a relationship shall not have relationships to any other part",
 	126: "a relationship identifier cannot be empty and shall be unique within the relationships part",
 	127: "a relationship type cannot be empty",
 	128: "a relationship target URI reference shall be a URI or a relative reference",
 	129: "a relationship target URI must be relative if the TargetMode is Internal",
+	130: "a relationship target URI shall not resolve to a location above the package root",
 	205: "a Default content type shall not have more than one content type for each extension and a Override shall not have more than one content type for each PartName",
 	206: "a package shall not have an empty extension in a Default element",
 	208: "a part content type shall appear in [Content_Types].xml",
+	303: "a package shall not contain equivalent ZIP item names",
+	305: "a package shall not contain a ZIP item representing a folder with the same name as a part",
 	310: "a package shall contain a file named [Content_Types].xml to store all the data content types",
+	315: "a package shall not contain encrypted ZIP items",
+	316: "a ZIP item shall be stored or compressed using the deflate algorithm",
+	317: "a package shall not span multiple disks",
+	318: "a ZIP item using Zip64 extensions shall declare version 4.5 as the version needed to extract",
+	402: "a core properties part shall not use the Markup Compatibility namespace",
+	403: "a core properties part shall not contain refinements to the Dublin Core elements other than dcterms:created and dcterms:modified",
+	404: "a core properties part shall not contain the xml:lang attribute",
+	405: "a core properties part shall only contain the xsi:type attribute in dcterms:created and dcterms:modified elements, with the dcterms:W3CDTF value",
 }
 
 // An Error from this package is always associated to an OPC entity that is not conformant with the OPC specs.
@@ -77,3 +91,14 @@ func (e *Error) Error() string {
 	}
 	return fmt.Sprintf("opc: %s: %s", e.partName, s)
 }
+
+// A LimitError is returned when the processing of a package exceeds one of the configured resource limits.
+type LimitError struct {
+	PartName string // The name of the part being processed when the limit was exceeded.
+	Limit    string // The description of the exceeded limit.
+	Value    int64  // The value of the exceeded limit.
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("opc: %s: %s limit of %d exceeded", e.PartName, e.Limit, e.Value)
+}
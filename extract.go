@@ -0,0 +1,163 @@
+package opc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractOptions configures how ExtractTo writes the package to disk.
+type ExtractOptions struct {
+	Relationships bool  // Also extract the relationship parts.
+	ContentTypes  bool  // Also extract the [Content_Types].xml stream.
+	MaxFileSize   int64 // Maximum size of a single extracted file. If zero there is no limit.
+	MaxTotalSize  int64 // Maximum size of all the extracted files together. If zero there is no limit.
+}
+
+// reservedNames are the device names that cannot be used as file names on Windows, with or without extension.
+var reservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {}, "CONIN$": {}, "CONOUT$": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// ExtractTo writes every part of the package to a file inside dir, which is created if it does not exist,
+// using the same name mapping as the ZIP items, and returns a manifest mapping each part name to its file path.
+// The core properties part is extracted as any other part, while the relationship parts and
+// the [Content_Types].xml stream are only extracted if requested in opts.
+//
+// The extraction is safe for packages coming from untrusted sources: the names that would
+// escape dir, are absolute, contain device names reserved on Windows or collide with another name
+// when compared case-insensitively are rejected, no file is written through a symbolic link,
+// and each file is written to a temporary file which is renamed once complete, so existing files are never partially overwritten.
+// If an error occurs the manifest contains the files that have already been extracted.
+func (r *Reader) ExtractTo(dir string, opts ExtractOptions) (map[string]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	items, err := r.extractItems(opts)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make(map[string]string, len(items))
+	var total int64
+	for _, it := range items {
+		it.path = filepath.Join(dir, it.rel)
+		n, err := extractFile(dir, it, opts.MaxFileSize, opts.MaxTotalSize-total, opts.MaxTotalSize)
+		if err != nil {
+			return manifest, err
+		}
+		total += n
+		manifest[it.partName] = it.path
+	}
+	return manifest, nil
+}
+
+type extractItem struct {
+	partName string
+	rel      string // path relative to the root folder, in the file system format
+	path     string // path of the extracted file
+	open     func() (io.ReadCloser, error)
+}
+
+// extractItems returns the items to be extracted, after checking that their paths are safe.
+func (r *Reader) extractItems(opts ExtractOptions) ([]extractItem, error) {
+	var items []extractItem
+	folded := make(map[string]string)
+	for _, file := range r.r.Files() {
+		name := file.Name()
+		partName := partNameFromZip(name)
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		open := file.Open
+		switch {
+		case PartNamesEquivalent(partName, contentTypesName):
+			if !opts.ContentTypes {
+				continue
+			}
+		case isRelationshipURI(partName):
+			if !opts.Relationships {
+				continue
+			}
+		default:
+			if f, ok := r.File(partName); ok {
+				partName, open = f.Name, f.Open
+			}
+		}
+		rel, err := extractPath(zipName(partNameFromZip(name)))
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(rel)
+		if other, ok := folded[key]; ok {
+			return nil, fmt.Errorf("opc: %s: cannot be extracted: the file name collides with %s", partName, other)
+		}
+		folded[key] = partName
+		items = append(items, extractItem{partName: partName, rel: rel, open: open})
+	}
+	return items, nil
+}
+
+// extractPath returns the relative path where an item is extracted.
+// It fails if the name is not safe to be used as a path on any operating system.
+func extractPath(name string) (string, error) {
+	p, err := dirPath("", name)
+	if err != nil {
+		return "", err
+	}
+	for _, seg := range strings.Split(name, "/") {
+		base := strings.ToUpper(strings.SplitN(seg, ".", 2)[0])
+		if _, ok := reservedNames[strings.TrimRight(base, " ")]; ok || strings.ContainsAny(seg, ":*?\"<>|") || strings.TrimRight(seg, ". ") != seg {
+			return "", fmt.Errorf("opc: %s: invalid file path", name)
+		}
+	}
+	return p, nil
+}
+
+// extractFile writes an item into its path inside root and returns the number of bytes written.
+// remaining is the number of bytes that can still be written if maxTotal is greater than zero.
+func extractFile(root string, it extractItem, maxFile, remaining, maxTotal int64) (n int64, err error) {
+	if err = mkdirNoSymlinks(root, filepath.Dir(it.rel)); err != nil {
+		return 0, err
+	}
+	rc, err := it.open()
+	if err != nil {
+		return 0, fmt.Errorf("opc: %s: cannot be opened: %v", it.partName, err)
+	}
+	defer rc.Close()
+	var src io.Reader = rc
+	if maxFile > 0 {
+		src = &limitedReader{r: src, n: maxFile, max: maxFile, partName: it.partName, limit: "extracted file size"}
+	}
+	if maxTotal > 0 {
+		src = &limitedReader{r: src, n: remaining, max: maxTotal, partName: it.partName, limit: "extracted total size"}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(it.path), ".opc-extract-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if n, err = io.Copy(tmp, src); err != nil {
+		return n, err
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		return n, err
+	}
+	if err = tmp.Close(); err != nil {
+		return n, err
+	}
+	if fi, lerr := os.Lstat(it.path); lerr == nil && !fi.Mode().IsRegular() {
+		err = fmt.Errorf("opc: %s: cannot be extracted: %s exists and is not a regular file", it.partName, it.path)
+		return n, err
+	}
+	err = os.Rename(tmp.Name(), it.path)
+	return n, err
+}
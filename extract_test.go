@@ -0,0 +1,143 @@
+package opc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReader_ExtractTo(t *testing.T) {
+	want := t.TempDir()
+	writeSamplePackage(t, NewDirWriter(want))
+	r := sampleReader(t)
+
+	dir := filepath.Join(t.TempDir(), "out")
+	manifest, err := r.ExtractTo(dir, ExtractOptions{Relationships: true, ContentTypes: true})
+	if err != nil {
+		t.Fatalf("Reader.ExtractTo() error = %v", err)
+	}
+	if got, want := readDir(t, dir), readDir(t, want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Reader.ExtractTo() = %v, want %v", got, want)
+	}
+	if got := manifest["/docs/%C3%A9t%C3%A9.xml"]; got != filepath.Join(dir, "docs", "été.xml") {
+		t.Errorf("Reader.ExtractTo() manifest = %v", manifest)
+	}
+	if len(manifest) != 8 {
+		t.Errorf("Reader.ExtractTo() manifest = %v, want 8 files", manifest)
+	}
+
+	// Extract again without the relationships and content types, overwriting the files
+	dir = t.TempDir()
+	manifest, err = r.ExtractTo(dir, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("Reader.ExtractTo() error = %v", err)
+	}
+	got := readDir(t, dir)
+	if _, ok := got["[Content_Types].xml"]; ok || len(got) != 5 || len(manifest) != 5 {
+		t.Errorf("Reader.ExtractTo() = %v, manifest = %v, want only the parts", got, manifest)
+	}
+	if fi, err := os.Stat(manifest["/docs/a.xml"]); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("Reader.ExtractTo() file = %v, %v", fi, err)
+	}
+}
+
+func TestReader_ExtractTo_limits(t *testing.T) {
+	r := sampleReader(t)
+	tests := []struct {
+		name  string
+		opts  ExtractOptions
+		limit string
+	}{
+		{"fileSize", ExtractOptions{MaxFileSize: 3}, "extracted file size"},
+		{"totalSize", ExtractOptions{MaxTotalSize: 10}, "extracted total size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := r.ExtractTo(dir, tt.opts)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("Reader.ExtractTo() error = %v, want %s limit", err, tt.limit)
+			}
+			for name := range readDir(t, dir) {
+				if filepath.Ext(name) != ".png" && filepath.Ext(name) != ".xml" {
+					t.Errorf("Reader.ExtractTo() left temporary file %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestReader_ExtractTo_hostile(t *testing.T) {
+	ct := new(cTypeBuilder).withDefault("application/xml", "xml").String()
+	for _, names := range [][]string{{"docs/CON.xml"}, {"docs/%C3%A9.xml", "docs/aux.xml"}, {"%C3%89.xml", "é.xml"}} {
+		a := newMemArchive()
+		w, _ := a.Create("[Content_Types].xml")
+		w.Write([]byte(ct))
+		for _, name := range names {
+			w, _ = a.Create(name)
+			w.Write([]byte("<a/>"))
+		}
+		r, err := NewReaderFromArchive(a, ReaderOptions{})
+		if err != nil {
+			t.Fatalf("NewReaderFromArchive() error = %v", err)
+		}
+		dir := t.TempDir()
+		if _, err = r.ExtractTo(dir, ExtractOptions{}); err == nil {
+			t.Errorf("Reader.ExtractTo(%v) want error", names)
+		}
+		if files := readDir(t, dir); len(files) != 0 {
+			t.Errorf("Reader.ExtractTo(%v) wrote %v", names, files)
+		}
+	}
+}
+
+func TestReader_ExtractTo_symlink(t *testing.T) {
+	r := sampleReader(t)
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "docs")); err != nil {
+		t.Skip("symbolic links not supported")
+	}
+	if _, err := r.ExtractTo(dir, ExtractOptions{}); err == nil {
+		t.Error("Reader.ExtractTo() want error for a symbolic link")
+	}
+	if files, _ := ioutil.ReadDir(outside); len(files) != 0 {
+		t.Errorf("Reader.ExtractTo() wrote outside the folder: %v", files)
+	}
+}
+
+func Test_extractPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"a/b.xml", filepath.Join("a", "b.xml"), false},
+		{"a/console.xml", filepath.Join("a", "console.xml"), false},
+		{"[Content_Types].xml", "[Content_Types].xml", false},
+		{"../a.xml", "", true},
+		{"/a.xml", "", true},
+		{"a/CON", "", true},
+		{"a/con.xml", "", true},
+		{"Lpt1.tar.gz", "", true},
+		{"nul /a.xml", "", true},
+		{"a/b.", "", true},
+		{"a/b ", "", true},
+		{"c:/a.xml", "", true},
+		{"a/b:stream", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractPath(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("extractPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
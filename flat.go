@@ -0,0 +1,472 @@
+package opc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	flatNS = "http://schemas.microsoft.com/office/2006/xmlPackage"
+	// flatXMLDeclaration is the declaration of the Flat OPC documents and of the inline XML parts read from them.
+	flatXMLDeclaration = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`
+)
+
+// NewFlatReader returns a new Reader reading a Flat OPC document from r,
+// which stores the whole package in a single XML document using the pkg:package schema.
+// The content types of the parts are taken from the pkg:contentType attributes.
+// The size of the document is limited by DefaultXMLLimits.
+// The pkg:xmlData elements cannot hold a XML declaration, so the inline XML parts
+// are given a UTF-8 standalone declaration, as Office does.
+func NewFlatReader(r io.Reader) (*Reader, error) {
+	a, err := newFlatArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(a)
+}
+
+// NewFlatWriter returns a new Writer writing a Flat OPC document to w.
+// XML parts are written inline in pkg:xmlData elements and the rest are base64 encoded in pkg:binaryData elements.
+// The document is written when the Writer is closed, the parts are kept in memory until then.
+func NewFlatWriter(w io.Writer) *Writer {
+	return NewWriterToArchive(&flatArchiveWriter{w: w})
+}
+
+type flatFile struct {
+	name string
+	b    []byte
+}
+
+func (f *flatFile) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(f.b)), nil
+}
+
+func (f *flatFile) Name() string {
+	return f.name
+}
+
+func (f *flatFile) Size() int {
+	return len(f.b)
+}
+
+type flatArchive struct {
+	files []ArchiveFile
+}
+
+func (a *flatArchive) Files() []ArchiveFile {
+	return a.files
+}
+
+func newFlatArchive(r io.Reader) (*flatArchive, error) {
+	ct := newPackage()
+	a := new(flatArchive)
+	tr := &flatTokenReader{s: newSecureTokenReader(r, "/", DefaultXMLLimits)}
+	d := xml.NewTokenDecoder(tr)
+	var (
+		part     *flatFile
+		depth    int
+		dataKind string
+		text     []byte
+		scope    [3][]xml.Attr // namespace declarations of the pkg:package, pkg:part and data elements
+	)
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, decodeError("/", err)
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && (t.Name.Space != flatNS || t.Name.Local != "package") {
+				return nil, fmt.Errorf("opc: /: invalid flat package root element %s", t.Name.Local)
+			}
+			if dataKind != "" {
+				continue
+			}
+			if depth <= len(scope) {
+				scope[depth-1] = namespaceDecls(tr.last.(xml.StartElement))
+			}
+			if t.Name.Space != flatNS {
+				continue
+			}
+			switch {
+			case depth == 2 && t.Name.Local == "part":
+				part, err = newFlatPart(t, ct)
+				if err != nil {
+					return nil, err
+				}
+			case depth == 3 && part != nil && (t.Name.Local == "xmlData" || t.Name.Local == "binaryData"):
+				dataKind, text = t.Name.Local, text[:0]
+				tr.recording, tr.rec = dataKind == "xmlData", nil
+			}
+		case xml.CharData:
+			if dataKind == "binaryData" && depth == 3 {
+				text = append(text, t...)
+			}
+		case xml.EndElement:
+			depth--
+			switch {
+			case depth == 2 && dataKind == "xmlData":
+				// The last recorded token is the end of the data element
+				part.b = append([]byte(flatXMLDeclaration+"\r\n"), encodeInlineXML(tr.rec[:len(tr.rec)-1], scope[:])...)
+				tr.recording, tr.rec, dataKind = false, nil, ""
+			case depth == 2 && dataKind != "":
+				if part.b, err = decodeBase64Lines(text); err != nil {
+					return nil, fmt.Errorf("opc: %s: cannot be decoded: %v", partNameFromZip(part.name), err)
+				}
+				dataKind = ""
+			case depth == 1 && part != nil:
+				a.files = append(a.files, part)
+				part = nil
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := ct.encodeContentTypes(&buf); err != nil {
+		return nil, err
+	}
+	a.files = append(a.files, &flatFile{name: contentTypesName[1:], b: buf.Bytes()})
+	return a, nil
+}
+
+// flatTokenReader keeps a copy of the raw tokens read from s, which preserve the namespace prefixes,
+// so the inline XML parts can be written back as found in the document.
+type flatTokenReader struct {
+	s         *secureTokenReader
+	last      xml.Token
+	recording bool
+	rec       []xml.Token
+}
+
+// emptyEnd is the end of an empty element written as a single tag.
+type emptyEnd xml.EndElement
+
+func (r *flatTokenReader) Token() (xml.Token, error) {
+	offset := r.s.d.InputOffset()
+	t, err := r.s.Token()
+	if err != nil {
+		return t, err
+	}
+	r.last = xml.CopyToken(t)
+	if r.recording {
+		rec := r.last
+		if end, ok := t.(xml.EndElement); ok && r.s.d.InputOffset() == offset {
+			rec = emptyEnd(end)
+		}
+		r.rec = append(r.rec, rec)
+	}
+	return t, nil
+}
+
+// namespaceDecls returns the namespace declarations of the raw element t.
+func namespaceDecls(t xml.StartElement) []xml.Attr {
+	var decls []xml.Attr
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			decls = append(decls, attr)
+		}
+	}
+	return decls
+}
+
+// encodeInlineXML writes the raw tokens of an inline XML part,
+// adding to its root element the declarations found in scope of the namespace prefixes it uses.
+func encodeInlineXML(tokens []xml.Token, scope [][]xml.Attr) []byte {
+	decls := inheritedDecls(tokens, scope)
+	var buf bytes.Buffer
+	depth := 0
+	for i, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			buf.WriteByte('<')
+			buf.WriteString(rawName(t.Name))
+			attrs := t.Attr
+			if depth == 0 {
+				attrs = append(decls[:len(decls):len(decls)], attrs...)
+			}
+			for _, attr := range attrs {
+				buf.WriteByte(' ')
+				buf.WriteString(rawName(attr.Name))
+				buf.WriteString(`="`)
+				escapeInline(&buf, attr.Value, true)
+				buf.WriteByte('"')
+			}
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(emptyEnd); ok {
+					buf.WriteByte('/')
+				}
+			}
+			buf.WriteByte('>')
+			depth++
+		case emptyEnd:
+			depth--
+		case xml.EndElement:
+			depth--
+			buf.WriteString("</" + rawName(t.Name) + ">")
+		case xml.CharData:
+			escapeInline(&buf, string(t), false)
+		case xml.Comment:
+			buf.WriteString("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			buf.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				buf.WriteString(" " + string(t.Inst))
+			}
+			buf.WriteString("?>")
+		case xml.Directive:
+			buf.WriteString("<!" + string(t) + ">")
+		}
+	}
+	return bytes.TrimSpace(buf.Bytes())
+}
+
+// inheritedDecls returns the declarations in scope of the prefixes used but not declared by tokens,
+// being the innermost element the last one of scope.
+func inheritedDecls(tokens []xml.Token, scope [][]xml.Attr) []xml.Attr {
+	var (
+		declared []string
+		marks    []int
+		used     = make(map[string]bool)
+	)
+	use := func(prefix string) {
+		if prefix == "xml" || prefix == "xmlns" {
+			return
+		}
+		for _, p := range declared {
+			if p == prefix {
+				return
+			}
+		}
+		used[prefix] = true
+	}
+	for _, t := range tokens {
+		switch t := t.(type) {
+		case xml.StartElement:
+			marks = append(marks, len(declared))
+			for _, attr := range namespaceDecls(t) {
+				declared = append(declared, declPrefix(attr))
+			}
+			use(t.Name.Space)
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "" {
+					use(attr.Name.Space)
+				}
+			}
+		case xml.EndElement, emptyEnd:
+			declared = declared[:marks[len(marks)-1]]
+			marks = marks[:len(marks)-1]
+		}
+	}
+	inScope := make(map[string]xml.Attr)
+	for _, decls := range scope {
+		for _, attr := range decls {
+			inScope[declPrefix(attr)] = attr
+		}
+	}
+	var decls []xml.Attr
+	for prefix := range used {
+		if attr, ok := inScope[prefix]; ok && attr.Value != "" {
+			decls = append(decls, attr)
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return declPrefix(decls[i]) < declPrefix(decls[j]) })
+	return decls
+}
+
+// declPrefix returns the prefix declared by a namespace declaration, empty for the default namespace.
+func declPrefix(attr xml.Attr) string {
+	if attr.Name.Space == "xmlns" {
+		return attr.Name.Local
+	}
+	return ""
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// escapeInline writes s escaping the characters that would change its value when parsed again.
+func escapeInline(buf *bytes.Buffer, s string, attr bool) {
+	for _, r := range s {
+		switch {
+		case r == '&':
+			buf.WriteString("&amp;")
+		case r == '<':
+			buf.WriteString("&lt;")
+		case r == '>':
+			buf.WriteString("&gt;")
+		case r == '\r':
+			buf.WriteString("&#xD;")
+		case attr && r == '"':
+			buf.WriteString("&quot;")
+		case attr && r == '\t':
+			buf.WriteString("&#x9;")
+		case attr && r == '\n':
+			buf.WriteString("&#xA;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func newFlatPart(t xml.StartElement, p *pkg) (*flatFile, error) {
+	var name, contentType string
+	for _, attr := range t.Attr {
+		if attr.Name.Space != flatNS {
+			continue
+		}
+		switch attr.Name.Local {
+		case "name":
+			name = attr.Value
+		case "contentType":
+			contentType = attr.Value
+		}
+	}
+	if !strings.HasPrefix(name, "/") || contentType == "" {
+		return nil, fmt.Errorf("opc: %s: flat part requires a name and a content type", name)
+	}
+	p.contentTypes.addOverride(name, contentType)
+	return &flatFile{name: zipName(name)}, nil
+}
+
+func decodeBase64Lines(b []byte) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, string(b)))
+}
+
+type flatArchiveWriter struct {
+	w     io.Writer
+	files []*flatFile
+	last  *bytes.Buffer
+}
+
+func (w *flatArchiveWriter) Create(name string) (io.Writer, error) {
+	w.flushLast()
+	w.files = append(w.files, &flatFile{name: name})
+	w.last = new(bytes.Buffer)
+	return w.last, nil
+}
+
+func (w *flatArchiveWriter) flushLast() {
+	if w.last != nil {
+		w.files[len(w.files)-1].b = w.last.Bytes()
+		w.last = nil
+	}
+}
+
+func (w *flatArchiveWriter) Close() error {
+	w.flushLast()
+	var ct *contentTypes
+	for _, f := range w.files {
+		if f.name == contentTypesName[1:] {
+			var err error
+			if ct, err = decodeContentTypes(bytes.NewReader(f.b)); err != nil {
+				return err
+			}
+		}
+	}
+	if ct == nil {
+		return newError(310, "/")
+	}
+	var buf bytes.Buffer
+	buf.WriteString(flatXMLDeclaration + "\n")
+	buf.WriteString(`<pkg:package xmlns:pkg="` + flatNS + `">` + "\n")
+	for _, f := range w.files {
+		if f.name == contentTypesName[1:] {
+			continue
+		}
+		name := partNameFromZip(f.name)
+		contentType, err := ct.findType(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, `<pkg:part pkg:name="%s" pkg:contentType="%s">`, xmlEscape(name), xmlEscape(contentType))
+		if isXMLContentType(contentType) && isInlineXML(f.b) {
+			buf.WriteString("<pkg:xmlData>")
+			buf.Write(stripXMLDeclaration(f.b))
+			buf.WriteString("</pkg:xmlData>")
+		} else {
+			buf.WriteString("<pkg:binaryData>")
+			writeBase64Lines(&buf, f.b)
+			buf.WriteString("</pkg:binaryData>")
+		}
+		buf.WriteString("</pkg:part>\n")
+	}
+	buf.WriteString("</pkg:package>")
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func isXMLContentType(contentType string) bool {
+	t := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	return t == "application/xml" || t == "text/xml" || strings.HasSuffix(t, "+xml")
+}
+
+// isInlineXML returns true if b is a well-formed XML document that can be embedded in another document.
+func isInlineXML(b []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	root, depth := 0, 0
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return root == 1
+		}
+		if err != nil {
+			return false
+		}
+		switch t.(type) {
+		case xml.Directive:
+			return false
+		case xml.StartElement:
+			if depth == 0 {
+				root++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// stripXMLDeclaration removes the XML declaration, which is not allowed inside another document.
+func stripXMLDeclaration(b []byte) []byte {
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("<?xml")) {
+		if i := bytes.Index(b, []byte("?>")); i >= 0 {
+			b = bytes.TrimSpace(b[i+2:])
+		}
+	}
+	return b
+}
+
+func writeBase64Lines(w *bytes.Buffer, b []byte) {
+	s := base64.StdEncoding.EncodeToString(b)
+	for len(s) > 76 {
+		w.WriteString(s[:76])
+		w.WriteByte('\n')
+		s = s[76:]
+	}
+	w.WriteString(s)
+}
@@ -0,0 +1,165 @@
+package opc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFlat_roundTrip(t *testing.T) {
+	flat1 := new(bytes.Buffer)
+	writeSamplePackage(t, NewFlatWriter(flat1))
+	for _, s := range []string{
+		`<pkg:part pkg:name="/docs/a.xml" pkg:contentType="application/xml"><pkg:xmlData><a/></pkg:xmlData></pkg:part>`,
+		`<pkg:part pkg:name="/docs/media/b.png" pkg:contentType="image/png"><pkg:binaryData>cG5nIGNvbnRlbnQ=</pkg:binaryData></pkg:part>`,
+		`pkg:name="/_rels/.rels" pkg:contentType="application/vnd.openxmlformats-package.relationships+xml"><pkg:xmlData><Relationships`,
+	} {
+		if !strings.Contains(flat1.String(), s) {
+			t.Errorf("NewFlatWriter() missing %s in %s", s, flat1)
+		}
+	}
+
+	r, err := NewFlatReader(bytes.NewReader(flat1.Bytes()))
+	if err != nil {
+		t.Fatalf("NewFlatReader() error = %v", err)
+	}
+	decl := flatXMLDeclaration + "\r\n"
+	want := map[string]string{"/docs/a.xml": decl + "<a/>", "/docs/media/b.png": "png content", "/docs/%C3%A9t%C3%A9.xml": decl + "<b/>"}
+	for _, f := range r.Files {
+		if content, ok := want[f.Name]; ok {
+			rc, _ := f.Open()
+			b, _ := ioutil.ReadAll(rc)
+			rc.Close()
+			if string(b) != content {
+				t.Errorf("File(%s) = %s, want %s", f.Name, b, content)
+			}
+			delete(want, f.Name)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("NewFlatReader() missing parts %v", want)
+	}
+	if r.Properties.Title != "Song" || len(r.Relationships) != 2 {
+		t.Errorf("NewFlatReader() properties = %v, relationships = %v", r.Properties, r.Relationships)
+	}
+
+	// Convert the Flat OPC document to a ZIP package and back
+	buf := new(bytes.Buffer)
+	copyPackage(t, r, NewWriter(buf))
+	zr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	flat2 := new(bytes.Buffer)
+	copyPackage(t, zr, NewFlatWriter(flat2))
+	if flat2.String() != flat1.String() {
+		t.Errorf("round trip = %s, want %s", flat2, flat1)
+	}
+	r2, err := NewFlatReader(bytes.NewReader(flat2.Bytes()))
+	if err != nil {
+		t.Fatalf("NewFlatReader() error = %v", err)
+	}
+	if got, want := partContents(t, r2), partContents(t, r); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip parts = %q, want %q", got, want)
+	}
+	if got, want := partContents(t, zr), partContents(t, r); !reflect.DeepEqual(got, want) {
+		t.Errorf("ZIP parts = %q, want %q", got, want)
+	}
+}
+
+func partContents(t *testing.T, r *Reader) map[string]string {
+	t.Helper()
+	contents := make(map[string]string, len(r.Files))
+	for _, f := range r.Files {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("File.Open() error = %v", err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		contents[f.Name] = string(b)
+	}
+	return contents
+}
+
+func TestNewFlatReader(t *testing.T) {
+	const header = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`
+	const root = `<pkg:package xmlns:pkg="http://schemas.microsoft.com/office/2006/xmlPackage">`
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr bool
+	}{
+		{"base", header + root + `<pkg:part pkg:name="/a.bin" pkg:contentType="application/octet-stream"><pkg:binaryData>YWJj
+ZGVm</pkg:binaryData></pkg:part></pkg:package>`, false},
+		{"doctype", header + `<!DOCTYPE pkg:package [<!ENTITY a "b">]>` + root + `</pkg:package>`, true},
+		{"badRoot", `<pkg:document xmlns:pkg="http://schemas.microsoft.com/office/2006/xmlPackage"/>`, true},
+		{"noNamespace", `<package/>`, true},
+		{"noContentType", root + `<pkg:part pkg:name="/a.bin"><pkg:binaryData>YWJj</pkg:binaryData></pkg:part></pkg:package>`, true},
+		{"badBase64", root + `<pkg:part pkg:name="/a.bin" pkg:contentType="application/octet-stream"><pkg:binaryData>*</pkg:binaryData></pkg:part></pkg:package>`, true},
+		{"malformed", root + `<pkg:part>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewFlatReader(strings.NewReader(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFlatReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(r.Files) != 1 || r.Files[0].ContentType != "application/octet-stream" {
+				t.Fatalf("NewFlatReader() files = %v", r.Files)
+			}
+			rc, _ := r.Files[0].Open()
+			b, _ := ioutil.ReadAll(rc)
+			if string(b) != "abcdef" {
+				t.Errorf("NewFlatReader() content = %s, want abcdef", b)
+			}
+		})
+	}
+}
+
+func TestNewFlatReader_doctypeError(t *testing.T) {
+	_, err := NewFlatReader(strings.NewReader(`<!DOCTYPE a><a/>`))
+	var opcErr *Error
+	if !errors.As(err, &opcErr) || opcErr.Code() != 118 {
+		t.Errorf("NewFlatReader() error = %v, want code 118", err)
+	}
+}
+
+func TestNewFlatReader_namespaces(t *testing.T) {
+	doc := `<pkg:package xmlns:pkg="http://schemas.microsoft.com/office/2006/xmlPackage" xmlns:w="http://w" xmlns:x="http://x">` +
+		`<pkg:part pkg:name="/a.xml" pkg:contentType="application/xml" xmlns:w="http://w2" xmlns="http://d"><pkg:xmlData>` + "\n" +
+		`<w:doc w:val="a&amp;&quot;b"><w:p xmlns:x="http://x2"><x:r/></w:p><v:s xmlns:v="http://v">1 &lt; 2</v:s><e></e><!--c--></w:doc>` + "\n" +
+		`</pkg:xmlData></pkg:part></pkg:package>`
+	r, err := NewFlatReader(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("NewFlatReader() error = %v", err)
+	}
+	rc, _ := r.Files[0].Open()
+	b, _ := ioutil.ReadAll(rc)
+	want := flatXMLDeclaration + "\r\n" + `<w:doc xmlns="http://d" xmlns:w="http://w2" w:val="a&amp;&quot;b"><w:p xmlns:x="http://x2"><x:r/></w:p><v:s xmlns:v="http://v">1 &lt; 2</v:s><e></e><!--c--></w:doc>`
+	if string(b) != want {
+		t.Errorf("NewFlatReader() content = %s, want %s", b, want)
+	}
+	if err := ValidateXML(bytes.NewReader(b), nil); err != nil {
+		t.Errorf("ValidateXML() error = %v", err)
+	}
+}
+
+func TestNewFlatReader_maxSize(t *testing.T) {
+	old := DefaultXMLLimits
+	defer func() { DefaultXMLLimits = old }()
+	DefaultXMLLimits.MaxSize = 100
+	doc := `<pkg:package xmlns:pkg="http://schemas.microsoft.com/office/2006/xmlPackage"><pkg:part pkg:name="/a.bin" pkg:contentType="application/octet-stream"><pkg:binaryData>` +
+		strings.Repeat("YWJj", 100) + `</pkg:binaryData></pkg:part></pkg:package>`
+	_, err := NewFlatReader(strings.NewReader(doc))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "XML size" {
+		t.Errorf("NewFlatReader() error = %v, want a size limit error", err)
+	}
+}
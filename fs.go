@@ -0,0 +1,312 @@
+package opc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"time"
+)
+
+// Check that Reader implements the io/fs interfaces.
+var (
+	_ fs.FS        = (*Reader)(nil)
+	_ fs.ReadDirFS = (*Reader)(nil)
+	_ fs.StatFS    = (*Reader)(nil)
+)
+
+// modTimeFile is implemented by the archive files that know their modification time.
+type modTimeFile interface {
+	ModTime() time.Time
+}
+
+// fsIndex indexes the parts by name and holds the tree of folders built from the part names.
+type fsIndex struct {
+	files map[string]*File // by canonical part name
+	dirs  map[string][]fs.DirEntry
+}
+
+func newFSIndex(files []*File) *fsIndex {
+	idx := &fsIndex{files: make(map[string]*File, len(files)), dirs: map[string][]fs.DirEntry{".": nil}}
+	for _, f := range files {
+		idx.files[CanonicalPartName(f.Name)] = f
+		name := zipName(f.Name)
+		entry := fs.FileInfoToDirEntry(newFileInfo(f))
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			_, exists := idx.dirs[dir]
+			idx.dirs[dir] = append(idx.dirs[dir], entry)
+			if exists || dir == "." {
+				break
+			}
+			entry = fs.FileInfoToDirEntry(&dirInfo{name: path.Base(dir)})
+		}
+	}
+	for _, entries := range idx.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return idx
+}
+
+// fsIndex returns the index of Files, which is built the first time it is needed.
+func (r *Reader) fsIndex() *fsIndex {
+	r.fsOnce.Do(func() {
+		r.fsys = newFSIndex(r.Files)
+	})
+	return r.fsys
+}
+
+// fileAt returns the part of a fs.FS path.
+func (r *Reader) fileAt(name string) (*File, bool) {
+	if name == "." {
+		return nil, false
+	}
+	return r.File(partNameFromZip(name))
+}
+
+// Open opens the named part or folder, implementing fs.FS.
+// The name is the part name without the leading slash and encoded as an IRI,
+// the same as the ZIP item names, such as "word/document.xml".
+// Part names are matched as in File, using the part name equivalence, while folder names are matched exactly.
+// Use OpenPart to open a part by its part name.
+// Only the parts in Files are available, the relationship parts
+// and the [Content_Types].xml stream are not.
+func (r *Reader) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := r.fileAt(name); ok {
+		return &fsFile{f: f, info: newFileInfo(f)}, nil
+	}
+	if entries, ok := r.fsIndex().dirs[name]; ok {
+		return &fsDir{info: &dirInfo{name: path.Base(name)}, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Stat returns a fs.FileInfo describing the named part or folder, implementing fs.StatFS.
+// The Sys method of the fs.FileInfo of a part returns its content type.
+func (r *Reader) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := r.fileAt(name); ok {
+		return newFileInfo(f), nil
+	}
+	if _, ok := r.fsIndex().dirs[name]; ok {
+		return &dirInfo{name: path.Base(name)}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir reads the named folder and returns its entries sorted by name, implementing fs.ReadDirFS.
+func (r *Reader) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, ok := r.fsIndex().dirs[name]
+	if !ok {
+		if _, ok = r.fileAt(name); ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// fileInfo describes a part.
+type fileInfo struct {
+	f *File
+}
+
+func newFileInfo(f *File) *fileInfo {
+	return &fileInfo{f: f}
+}
+
+func (fi *fileInfo) Name() string {
+	return path.Base(zipName(fi.f.Name))
+}
+
+func (fi *fileInfo) Size() int64 {
+	return int64(fi.f.Size)
+}
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	return 0444
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	if mf, ok := fi.f.a.(modTimeFile); ok {
+		return mf.ModTime()
+	}
+	return time.Time{}
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return false
+}
+
+// Sys returns the content type of the part.
+func (fi *fileInfo) Sys() interface{} {
+	return fi.f.ContentType
+}
+
+// dirInfo describes a folder, which only exists as a prefix of the part names.
+type dirInfo struct {
+	name string
+}
+
+func (di *dirInfo) Name() string {
+	return di.name
+}
+
+func (di *dirInfo) Size() int64 {
+	return 0
+}
+
+func (di *dirInfo) Mode() fs.FileMode {
+	return fs.ModeDir | 0555
+}
+
+func (di *dirInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (di *dirInfo) IsDir() bool {
+	return true
+}
+
+func (di *dirInfo) Sys() interface{} {
+	return nil
+}
+
+// fsFile is an open part. It supports seeking,
+// which uses File.OpenSeeker when possible and otherwise reopens the part and discards the data before the offset.
+type fsFile struct {
+	f    *File
+	info *fileInfo
+	rs   ReadSeekerAt  // random access reader, if supported
+	rc   io.ReadCloser // sequential reader, positioned at rpos
+	rpos int64
+	pos  int64
+	done bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsFile) init() error {
+	if f.rs != nil || f.rc != nil {
+		return nil
+	}
+	if rs, err := f.f.OpenSeeker(); err == nil {
+		f.rs = rs
+		return nil
+	}
+	rc, err := f.f.Open()
+	if err != nil {
+		return err
+	}
+	f.rc, f.rpos = rc, 0
+	return nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.done {
+		return 0, fs.ErrClosed
+	}
+	if err := f.init(); err != nil {
+		return 0, err
+	}
+	if f.rs != nil {
+		n, err := f.rs.ReadAt(p, f.pos)
+		f.pos += int64(n)
+		return n, err
+	}
+	if f.pos < f.rpos {
+		f.rc.Close()
+		f.rc = nil
+		if err := f.init(); err != nil {
+			return 0, err
+		}
+	}
+	if f.pos > f.rpos {
+		n, err := io.CopyN(ioutil.Discard, f.rc, f.pos-f.rpos)
+		f.rpos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.rc.Read(p)
+	f.pos += int64(n)
+	f.rpos += int64(n)
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.done {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(f.f.Size)
+	default:
+		return 0, errors.New("opc: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("opc: negative position")
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.done {
+		return fs.ErrClosed
+	}
+	f.done = true
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+	return nil
+}
+
+// fsDir is an open folder.
+type fsDir struct {
+	info    *dirInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return append([]fs.DirEntry(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return append([]fs.DirEntry(nil), rest[:n]...), nil
+}
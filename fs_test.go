@@ -0,0 +1,90 @@
+package opc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReader_FS(t *testing.T) {
+	r := sampleReader(t)
+	if err := fstest.TestFS(r, "docs/a.xml", "docs/media/b.png", "docs/été.xml", "c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.ReadFile(r, "docs/été.xml")
+	if err != nil || string(b) != "<b/>" {
+		t.Errorf("fs.ReadFile() = %s, %v", b, err)
+	}
+	matches, err := fs.Glob(r, "docs/*.xml")
+	if want := []string{"docs/a.xml", "docs/été.xml"}; err != nil || !reflect.DeepEqual(matches, want) {
+		t.Errorf("fs.Glob() = %v, %v, want %v", matches, err, want)
+	}
+	var walked []string
+	fs.WalkDir(r, ".", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	if want := []string{".", "c.txt", "docs", "docs/a.xml", "docs/media", "docs/media/b.png", "docs/été.xml"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("fs.WalkDir() = %v, want %v", walked, want)
+	}
+}
+
+func TestReader_Stat(t *testing.T) {
+	r := sampleReader(t)
+	fi, err := r.Stat("docs/media/b.png")
+	if err != nil {
+		t.Fatalf("Reader.Stat() error = %v", err)
+	}
+	if fi.Name() != "b.png" || fi.Size() != 11 || fi.IsDir() || fi.Sys() != "image/png" {
+		t.Errorf("Reader.Stat() = %v %v %v %v", fi.Name(), fi.Size(), fi.IsDir(), fi.Sys())
+	}
+	if time.Since(fi.ModTime()) > time.Hour {
+		t.Errorf("Reader.Stat() ModTime = %v", fi.ModTime())
+	}
+	if fi, err = r.Stat("docs/media"); err != nil || !fi.IsDir() {
+		t.Errorf("Reader.Stat() = %v, %v, want a folder", fi, err)
+	}
+	for _, name := range []string{"docs/x.xml", "_rels/.rels", "[Content_Types].xml"} {
+		if _, err = r.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Reader.Stat(%s) error = %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	for _, name := range []string{"/docs/a.xml", "docs/../c.txt"} {
+		if _, err = r.Stat(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Reader.Stat(%s) error = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestReader_Open_seek(t *testing.T) {
+	r := sampleReader(t)
+	for _, name := range []string{"c.txt", "docs/media/b.png"} {
+		f, err := r.Open(name)
+		if err != nil {
+			t.Fatalf("Reader.Open() error = %v", err)
+		}
+		fi, _ := f.Stat()
+		rs := f.(io.ReadSeeker)
+		if n, err := rs.Seek(-7, io.SeekEnd); err != nil || n != fi.Size()-7 {
+			t.Errorf("Seek() = %d, %v", n, err)
+		}
+		if b, _ := ioutil.ReadAll(rs); string(b) != "content" {
+			t.Errorf("%s: Read() after Seek = %s, want content", name, b)
+		}
+		rs.Seek(0, io.SeekStart)
+		if b, _ := ioutil.ReadAll(rs); len(b) < 9 {
+			t.Errorf("%s: Read() after rewind = %s", name, b)
+		}
+		if err = f.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if _, err = rs.Read(make([]byte, 1)); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("Read() after Close error = %v, want fs.ErrClosed", err)
+		}
+	}
+}
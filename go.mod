@@ -2,4 +2,12 @@ module github.com/qmuntal/opc
 
 require github.com/stretchr/testify v1.3.0
 
-go 1.13
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.0 // indirect
+)
+
+// Go 1.17 is required by zip.Writer.CreateRaw, used by the parallel compression,
+// and io/fs, used by the fs.FS support, requires Go 1.16.
+go 1.17
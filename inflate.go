@@ -0,0 +1,385 @@
+package opc
+
+import (
+	"bufio"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// maxWindow is the size of the DEFLATE sliding window.
+const maxWindow = 1 << 15
+
+var (
+	errCorruptDeflate = errors.New("corrupt deflate stream")
+	errInflateDone    = errors.New("inflate done")
+	errInflateSize    = errors.New("uncompressed data bigger than the declared size")
+)
+
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	codeOrder   = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// huffman is a canonical Huffman code decoded one bit at a time, as described in RFC 1951 §3.2.2.
+type huffman struct {
+	count  [16]uint16  // number of codes of each length
+	symbol [288]uint16 // symbols ordered by code
+}
+
+func (h *huffman) build(lengths []uint8) error {
+	h.count = [16]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	left := 1
+	for l := 1; l < 16; l++ {
+		left = left<<1 - int(h.count[l])
+		if left < 0 {
+			return errCorruptDeflate
+		}
+	}
+	// Incomplete codes are rejected as compress/flate does, except the empty code
+	// and a single code of one bit, which zlib accepts.
+	if codes := len(lengths) - int(h.count[0]); left > 0 && codes > 0 && !(codes == 1 && h.count[1] == 1) {
+		return errCorruptDeflate
+	}
+	var offs [16]uint16
+	for l := 1; l < 15; l++ {
+		offs[l+1] = offs[l] + h.count[l]
+	}
+	for s, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(s)
+			offs[l]++
+		}
+	}
+	return nil
+}
+
+// inflater is a simple DEFLATE decoder that keeps track of the position of each block
+// in the compressed stream and that can restart the decompression from any block,
+// which the standard library decoder does not support.
+// It only keeps the sliding window of the output, except the bytes that fall into dst.
+type inflater struct {
+	r    *bufio.Reader
+	in   int64 // bytes read from r
+	bits uint32
+	nb   uint
+	out  int64
+	win  [maxWindow]byte
+	crc  uint32
+	lit  huffman
+	dist huffman
+	dst  []byte // destination of the output starting at from, the decompression stops once it is full
+	from int64
+	max  int64 // the decompression fails once the output is bigger than max, if greater than zero
+}
+
+func newInflater(r io.Reader) *inflater {
+	return &inflater{r: bufio.NewReader(r)}
+}
+
+// newInflaterAt returns an inflater that starts decoding at the given bit of r,
+// which shall be the beginning of a block preceded by out uncompressed bytes,
+// being window the last of them.
+func newInflaterAt(r io.Reader, bit int64, out int64, window []byte) (*inflater, error) {
+	f := newInflater(r)
+	f.in = bit / 8
+	if _, err := f.getBits(uint(bit % 8)); err != nil {
+		return nil, err
+	}
+	f.out = out
+	for i, c := range window {
+		f.win[(out-int64(len(window))+int64(i))%maxWindow] = c
+	}
+	return f, nil
+}
+
+// full returns true if dst has been completely written.
+func (f *inflater) full() bool {
+	return f.dst != nil && f.out >= f.from+int64(len(f.dst))
+}
+
+// check returns errInflateDone if dst is full or errInflateSize if the output is bigger than max.
+func (f *inflater) check() error {
+	if f.full() {
+		return errInflateDone
+	}
+	if f.max > 0 && f.out > f.max {
+		return errInflateSize
+	}
+	return nil
+}
+
+// bitPos returns the number of bits consumed from the compressed stream.
+func (f *inflater) bitPos() int64 {
+	return f.in*8 - int64(f.nb)
+}
+
+// window returns the last uncompressed bytes, up to the window size.
+func (f *inflater) window() []byte {
+	if f.out <= maxWindow {
+		return append([]byte(nil), f.win[:f.out]...)
+	}
+	pos := f.out % maxWindow
+	return append(append(make([]byte, 0, maxWindow), f.win[pos:]...), f.win[:pos]...)
+}
+
+func (f *inflater) getBits(n uint) (uint32, error) {
+	for f.nb < n {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		f.in++
+		f.bits |= uint32(c) << f.nb
+		f.nb += 8
+	}
+	v := f.bits & (1<<n - 1)
+	f.bits >>= n
+	f.nb -= n
+	return v, nil
+}
+
+func (f *inflater) emit(c byte) {
+	if f.out >= f.from && f.out-f.from < int64(len(f.dst)) {
+		f.dst[f.out-f.from] = c
+	}
+	f.win[f.out%maxWindow] = c
+	f.out++
+	if f.out%maxWindow == 0 {
+		f.crc = crc32.Update(f.crc, crc32.IEEETable, f.win[:])
+	}
+}
+
+// checksum returns the CRC-32 of the uncompressed data.
+func (f *inflater) checksum() uint32 {
+	return crc32.Update(f.crc, crc32.IEEETable, f.win[:f.out%maxWindow])
+}
+
+func (f *inflater) decodeSymbol(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l < 16; l++ {
+		b, err := f.getBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(b)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorruptDeflate
+}
+
+// inflate decodes the whole stream calling block before each block.
+func (f *inflater) inflate(block func() error) error {
+	for {
+		if err := f.check(); err != nil {
+			return err
+		}
+		if err := block(); err != nil {
+			return err
+		}
+		last, err := f.getBits(1)
+		if err != nil {
+			return err
+		}
+		typ, err := f.getBits(2)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 0:
+			err = f.stored()
+		case 1:
+			err = f.fixed()
+		case 2:
+			err = f.dynamic()
+		default:
+			err = errCorruptDeflate
+		}
+		if err != nil {
+			return err
+		}
+		if last == 1 {
+			return nil
+		}
+	}
+}
+
+func (f *inflater) stored() error {
+	// Discard the remaining bits of the current byte
+	f.bits, f.nb = 0, 0
+	var hdr [4]byte
+	if _, err := io.ReadFull(f.r, hdr[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	f.in += 4
+	n := int(hdr[0]) | int(hdr[1])<<8
+	if nn := int(hdr[2]) | int(hdr[3])<<8; uint16(nn) != ^uint16(n) {
+		return errCorruptDeflate
+	}
+	for i := 0; i < n; i++ {
+		if err := f.check(); err != nil {
+			return err
+		}
+		c, err := f.r.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		f.in++
+		f.emit(c)
+	}
+	return nil
+}
+
+func (f *inflater) fixed() error {
+	// The distance codes 30 and 31 complete the code, they are rejected when decoded
+	var lengths [288 + 32]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		case i < 288:
+			lengths[i] = 8
+		default:
+			lengths[i] = 5
+		}
+	}
+	f.lit.build(lengths[:288])
+	f.dist.build(lengths[288:])
+	return f.codes()
+}
+
+func (f *inflater) dynamic() error {
+	v, err := f.getBits(14)
+	if err != nil {
+		return err
+	}
+	nlen, ndist, ncode := int(v&0x1F)+257, int(v>>5&0x1F)+1, int(v>>10)+4
+	if nlen > 286 || ndist > 30 {
+		return errCorruptDeflate
+	}
+	var lengths [288 + 32]uint8
+	for i := 0; i < ncode; i++ {
+		l, err := f.getBits(3)
+		if err != nil {
+			return err
+		}
+		lengths[codeOrder[i]] = uint8(l)
+	}
+	var lencode huffman
+	if err := lencode.build(lengths[:19]); err != nil {
+		return err
+	}
+	lengths = [288 + 32]uint8{}
+	for i := 0; i < nlen+ndist; {
+		sym, err := f.decodeSymbol(&lencode)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var rep uint32
+		var val uint8
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errCorruptDeflate
+			}
+			val = lengths[i-1]
+			rep, err = f.getBits(2)
+			rep += 3
+		case 17:
+			rep, err = f.getBits(3)
+			rep += 3
+		default:
+			rep, err = f.getBits(7)
+			rep += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(rep) > nlen+ndist {
+			return errCorruptDeflate
+		}
+		for ; rep > 0; rep-- {
+			lengths[i] = val
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return errCorruptDeflate
+	}
+	if err := f.lit.build(lengths[:nlen]); err != nil {
+		return err
+	}
+	if err := f.dist.build(lengths[nlen : nlen+ndist]); err != nil {
+		return err
+	}
+	return f.codes()
+}
+
+func (f *inflater) codes() error {
+	for {
+		if err := f.check(); err != nil {
+			return err
+		}
+		sym, err := f.decodeSymbol(&f.lit)
+		if err != nil {
+			return err
+		}
+		if sym < 256 {
+			f.emit(byte(sym))
+			continue
+		}
+		if sym == 256 {
+			return nil
+		}
+		sym -= 257
+		if sym >= len(lengthBase) {
+			return errCorruptDeflate
+		}
+		extra, err := f.getBits(uint(lengthExtra[sym]))
+		if err != nil {
+			return err
+		}
+		n := int(lengthBase[sym]) + int(extra)
+		dsym, err := f.decodeSymbol(&f.dist)
+		if err != nil {
+			return err
+		}
+		if dsym >= len(distBase) {
+			return errCorruptDeflate
+		}
+		if extra, err = f.getBits(uint(distExtra[dsym])); err != nil {
+			return err
+		}
+		dist := int64(distBase[dsym]) + int64(extra)
+		if dist > f.out {
+			return errCorruptDeflate
+		}
+		for ; n > 0; n-- {
+			f.emit(f.win[(f.out-dist)%maxWindow])
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build go1.18
+// +build go1.18
+
+package opc
+
+import (
+	"compress/flate"
+	"testing"
+)
+
+func Fuzz_inflater(f *testing.F) {
+	for _, level := range []int{flate.NoCompression, flate.HuffmanOnly, flate.BestSpeed, flate.BestCompression} {
+		f.Add(deflate(f, testContent(2000), level))
+	}
+	f.Add([]byte{0x07})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		diffInflate(t, data, 1<<20)
+	})
+}
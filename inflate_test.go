@@ -0,0 +1,169 @@
+package opc
+
+import (
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func testContent(n int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"<mesh>", "<vertex x=\"", "1.25", "\" y=\"", "-3.5", "\"/>", "</mesh>", "\n"}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		if rnd.Intn(10) == 0 {
+			buf.WriteByte(byte(rnd.Intn(256)))
+		}
+		buf.WriteString(words[rnd.Intn(len(words))])
+	}
+	return buf.Bytes()[:n]
+}
+
+func deflate(t testing.TB, b []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(b)
+	fw.Close()
+	return buf.Bytes()
+}
+
+func Test_inflater(t *testing.T) {
+	content := testContent(300 << 10)
+	tests := []struct {
+		name  string
+		level int
+	}{
+		{"stored", flate.NoCompression},
+		{"huffman", flate.HuffmanOnly},
+		{"fast", flate.BestSpeed},
+		{"default", flate.DefaultCompression},
+		{"best", flate.BestCompression},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inf := newInflater(bytes.NewReader(deflate(t, content, tt.level)))
+			var blocks int
+			if err := inf.inflate(func() error { blocks++; return nil }); err != nil {
+				t.Fatalf("inflater.inflate() error = %v", err)
+			}
+			if inf.out != int64(len(content)) {
+				t.Errorf("inflater.inflate() size = %d, want %d", inf.out, len(content))
+			}
+			if got := inf.checksum(); got != crc32.ChecksumIEEE(content) {
+				t.Errorf("inflater.inflate() checksum = %x, want %x", got, crc32.ChecksumIEEE(content))
+			}
+			if !bytes.Equal(inf.window(), content[len(content)-maxWindow:]) {
+				t.Error("inflater.window() does not match the content")
+			}
+			if blocks < 2 {
+				t.Errorf("inflater.inflate() blocks = %d, want several", blocks)
+			}
+		})
+	}
+}
+
+func Test_inflater_corrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"reservedType", []byte{0x07}},
+		{"storedLength", []byte{0x01, 0x01, 0x00, 0x00, 0x00}},
+		{"truncated", deflate(t, testContent(1000), flate.BestSpeed)[:20]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := newInflater(bytes.NewReader(tt.data)).inflate(func() error { return nil }); err == nil {
+				t.Error("inflater.inflate() want error")
+			}
+		})
+	}
+}
+
+func Test_newInflaterAt(t *testing.T) {
+	content := testContent(200 << 10)
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.DefaultCompression} {
+		compressed := deflate(t, content, level)
+		var checkpoints []SeekCheckpoint
+		inf := newInflater(bytes.NewReader(compressed))
+		inf.inflate(func() error {
+			checkpoints = append(checkpoints, SeekCheckpoint{In: inf.bitPos(), Out: inf.out, Window: inf.window()})
+			return nil
+		})
+		for _, c := range checkpoints {
+			if c.Out+110 > int64(len(content)) {
+				continue
+			}
+			inf, err := newInflaterAt(bytes.NewReader(compressed[c.In/8:]), c.In, c.Out, c.Window)
+			if err != nil {
+				t.Fatalf("newInflaterAt() error = %v", err)
+			}
+			inf.dst, inf.from = make([]byte, 100), c.Out+10
+			if err := inf.inflate(func() error { return nil }); err != errInflateDone {
+				t.Fatalf("inflater.inflate() error = %v", err)
+			}
+			if !bytes.Equal(inf.dst, content[c.Out+10:c.Out+110]) {
+				t.Errorf("inflater.inflate() from %d returned wrong content", c.Out)
+			}
+		}
+	}
+}
+
+// diffInflate decompresses data with the inflater and compress/flate and fails if the results differ.
+// Streams bigger than max are not compared.
+func diffInflate(t testing.TB, data []byte, max int) {
+	t.Helper()
+	want, werr := ioutil.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), int64(max)+1))
+	inf := newInflater(bytes.NewReader(data))
+	inf.dst = make([]byte, max+1)
+	err := inf.inflate(func() error { return nil })
+	if err == errInflateDone || len(want) > max {
+		return
+	}
+	if (err != nil) != (werr != nil) {
+		t.Fatalf("inflater.inflate() error = %v, compress/flate error = %v", err, werr)
+	}
+	if err != nil {
+		return
+	}
+	if got := inf.dst[:inf.out]; !bytes.Equal(got, want) {
+		t.Fatalf("inflater.inflate() = %q, compress/flate = %q", got, want)
+	}
+	if got := inf.checksum(); got != crc32.ChecksumIEEE(want) {
+		t.Fatalf("inflater.checksum() = %x, want %x", got, crc32.ChecksumIEEE(want))
+	}
+}
+
+func Test_inflater_differential(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, level := range []int{flate.NoCompression, flate.HuffmanOnly, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression} {
+		for _, n := range []int{0, 1, 100, 5000, 70000} {
+			data := deflate(t, testContent(n), level)
+			diffInflate(t, data, 1<<20)
+			// Corrupt the stream flipping bits, truncating and appending garbage
+			for i := 0; i < 200 && len(data) > 0; i++ {
+				corrupt := append([]byte(nil), data...)
+				for j := rnd.Intn(4); j >= 0; j-- {
+					corrupt[rnd.Intn(len(corrupt))] ^= 1 << uint(rnd.Intn(8))
+				}
+				diffInflate(t, corrupt, 1<<20)
+				diffInflate(t, corrupt[:rnd.Intn(len(corrupt))], 1<<20)
+			}
+			diffInflate(t, append(append([]byte(nil), data...), 0xFF, 0x00), 1<<20)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		random := make([]byte, rnd.Intn(64))
+		rnd.Read(random)
+		diffInflate(t, random, 1<<20)
+	}
+}
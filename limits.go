@@ -0,0 +1,94 @@
+package opc
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReaderLimits defines the resources that can be consumed when reading a package,
+// which protects from hostile packages such as ZIP bombs.
+// A zero value field means that there is no limit.
+type ReaderLimits struct {
+	MaxParts            int     // Maximum number of items of the archive, including the relationship parts.
+	MaxRelationships    int     // Maximum number of relationships of the package or of a single part.
+	MaxXMLPartSize      int64   // Maximum uncompressed size of the [Content_Types].xml stream, the relationship parts and the core properties part.
+	MaxTotalSize        int64   // Maximum uncompressed size of all the items together.
+	MaxCompressionRatio float64 // Maximum ratio between the uncompressed and the compressed size of an item. Items smaller than 64KB are not checked.
+}
+
+// minRatioSize is the size from which the compression ratio of an item is checked,
+// small items are harmless and can have high compression ratios.
+const minRatioSize = 64 << 10
+
+// DefaultReaderLimits are reasonable limits for reading packages from untrusted sources.
+// They are not applied unless set in ReaderOptions.
+var DefaultReaderLimits = ReaderLimits{
+	MaxParts:            10000,
+	MaxRelationships:    10000,
+	MaxXMLPartSize:      10 << 20,
+	MaxTotalSize:        1 << 30,
+	MaxCompressionRatio: 100,
+}
+
+// compressedFile is implemented by the archive files that know their compressed size.
+type compressedFile interface {
+	CompressedSize() int64
+}
+
+func (l *ReaderLimits) enabled() bool {
+	return *l != ReaderLimits{}
+}
+
+// checkArchive checks the limits that only depend on the item headers.
+func (l *ReaderLimits) checkArchive(files []ArchiveFile) error {
+	if l.MaxParts > 0 && len(files) > l.MaxParts {
+		return &LimitError{PartName: "/", Limit: "parts", Value: int64(l.MaxParts)}
+	}
+	var total int64
+	for _, file := range files {
+		size := int64(file.Size())
+		total += size
+		if l.MaxTotalSize > 0 && total > l.MaxTotalSize {
+			return &LimitError{PartName: "/", Limit: "total size", Value: l.MaxTotalSize}
+		}
+		if cf, ok := file.(compressedFile); ok && l.MaxCompressionRatio > 0 && size >= minRatioSize {
+			if c := cf.CompressedSize(); c <= 0 || float64(size)/float64(c) > l.MaxCompressionRatio {
+				return &LimitError{PartName: partNameFromZip(file.Name()), Limit: "compression ratio", Value: int64(l.MaxCompressionRatio)}
+			}
+		}
+	}
+	return nil
+}
+
+// checkRelationships checks the number of relationships of a source part.
+func (l *ReaderLimits) checkRelationships(partName string, rels []*Relationship) error {
+	if l.MaxRelationships > 0 && len(rels) > l.MaxRelationships {
+		return &LimitError{PartName: partName, Limit: "relationships", Value: int64(l.MaxRelationships)}
+	}
+	return nil
+}
+
+// openXML opens an item which contains package metadata, enforcing MaxXMLPartSize.
+func (l *ReaderLimits) openXML(file ArchiveFile, partName string) (io.ReadCloser, error) {
+	if l.MaxXMLPartSize > 0 && int64(file.Size()) > l.MaxXMLPartSize {
+		return nil, &LimitError{PartName: partName, Limit: "XML part size", Value: l.MaxXMLPartSize}
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("opc: %s: cannot be opened: %v", partName, err)
+	}
+	if l.MaxXMLPartSize > 0 {
+		return newLimitedReadCloser(rc, partName, "XML part size", l.MaxXMLPartSize), nil
+	}
+	return rc, nil
+}
+
+type limitedReadCloser struct {
+	*limitedReader
+	io.Closer
+}
+
+// newLimitedReadCloser returns a ReadCloser that fails with a LimitError when more than max bytes are read from rc.
+func newLimitedReadCloser(rc io.ReadCloser, partName, limit string, max int64) io.ReadCloser {
+	return &limitedReadCloser{&limitedReader{r: rc, n: max, max: max, partName: partName, limit: limit}, rc}
+}
@@ -0,0 +1,125 @@
+package opc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func numbers(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(strconv.Itoa(i))
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func TestReaderOptions_Limits(t *testing.T) {
+	ct := new(cTypeBuilder).withDefault("application/xml", "xml").withDefault("application/vnd.openxmlformats-package.relationships+xml", "rels").String()
+	rels := new(relsBuilder).withRel("rId1", "t", "a.xml").withRel("rId2", "t", "b.xml").withRel("rId3", "t", "c.xml").String()
+	b := buildPackage(t, map[string]string{
+		"[Content_Types].xml": ct,
+		"_rels/.rels":         rels,
+		"a.xml":               "<a/>",
+		"_rels/a.xml.rels":    rels,
+		"b.xml":               "<b>" + numbers(20000) + "</b>",
+		"c.xml":               "<c/>",
+	})
+	tests := []struct {
+		name      string
+		limits    ReaderLimits
+		wantLimit string
+	}{
+		{"none", ReaderLimits{}, ""},
+		{"default", DefaultReaderLimits, ""},
+		{"parts", ReaderLimits{MaxParts: 5}, "parts"},
+		{"relationships", ReaderLimits{MaxRelationships: 2}, "relationships"},
+		{"xmlPartSize", ReaderLimits{MaxXMLPartSize: 100}, "XML part size"},
+		{"totalSize", ReaderLimits{MaxTotalSize: 10000}, "total size"},
+		{"compressionRatio", ReaderLimits{MaxCompressionRatio: 2}, "compression ratio"},
+		{"enough", ReaderLimits{MaxParts: 6, MaxRelationships: 3, MaxXMLPartSize: 1000, MaxTotalSize: 200000, MaxCompressionRatio: 5000}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []RelationshipsLoading{LoadSequential, LoadParallel} {
+				_, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{Relationships: mode, Limits: tt.limits})
+				var limitErr *LimitError
+				if tt.wantLimit == "" {
+					if err != nil {
+						t.Errorf("NewReaderWithOptions() error = %v", err)
+					}
+				} else if !errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit {
+					t.Errorf("NewReaderWithOptions() error = %v, want %s limit", err, tt.wantLimit)
+				}
+			}
+		})
+	}
+}
+
+func TestReaderOptions_Limits_lazy(t *testing.T) {
+	ct := new(cTypeBuilder).withDefault("application/xml", "xml").withDefault("application/vnd.openxmlformats-package.relationships+xml", "rels").String()
+	b := buildPackage(t, map[string]string{
+		"[Content_Types].xml": ct,
+		"a.xml":               "<a/>",
+		"_rels/a.xml.rels":    new(relsBuilder).withRel("rId1", "t", "a.xml").withRel("rId2", "t", "a.xml").String(),
+	})
+	r, err := NewReaderWithOptions(bytes.NewReader(b), int64(len(b)), ReaderOptions{Relationships: LoadLazy, Limits: ReaderLimits{MaxRelationships: 1}})
+	if err != nil {
+		t.Fatalf("NewReaderWithOptions() error = %v", err)
+	}
+	var limitErr *LimitError
+	if _, err = r.Files[0].LoadRelationships(); !errors.As(err, &limitErr) || limitErr.Limit != "relationships" {
+		t.Errorf("File.LoadRelationships() error = %v, want relationships limit", err)
+	}
+}
+
+// lyingArchive reports a smaller size than the real one for the parts.
+type lyingArchive struct {
+	*memArchive
+}
+
+func (a lyingArchive) Files() []ArchiveFile {
+	files := a.memArchive.Files()
+	for i, f := range files {
+		if strings.HasSuffix(f.Name(), ".bin") {
+			files[i] = lyingFile{f.(memFile)}
+		}
+	}
+	return files
+}
+
+type lyingFile struct {
+	memFile
+}
+
+func (f lyingFile) Size() int { return 1 }
+
+func TestFile_Open_limits(t *testing.T) {
+	a := newMemArchive()
+	w := NewWriterToArchive(a)
+	pw, _ := w.Create("/a.bin", "application/octet-stream")
+	pw.Write([]byte(strings.Repeat("a", 1000)))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	for _, limits := range []ReaderLimits{{}, {MaxTotalSize: 10000}} {
+		r, err := NewReaderFromArchive(lyingArchive{a}, ReaderOptions{Limits: limits})
+		if err != nil {
+			t.Fatalf("NewReaderFromArchive() error = %v", err)
+		}
+		rc, _ := r.Files[0].Open()
+		_, err = ioutil.ReadAll(rc)
+		var limitErr *LimitError
+		if limits == (ReaderLimits{}) {
+			if err != nil {
+				t.Errorf("File.Open() without limits error = %v", err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != "part size" || limitErr.PartName != "/a.bin" {
+			t.Errorf("File.Open() error = %v, want part size limit", err)
+		}
+	}
+}
@@ -9,7 +9,6 @@ package opc
 
 import (
 	"encoding/xml"
-	"fmt"
 	"io"
 	"mime"
 	"path/filepath"
@@ -29,6 +28,7 @@ const (
 type pkg struct {
 	parts        map[string]*Part
 	contentTypes contentTypes
+	index        *partIndex // lazily built from parts
 }
 
 func newPackage() *pkg {
@@ -38,7 +38,7 @@ func newPackage() *pkg {
 }
 
 func (p *pkg) partExists(partName string) bool {
-	_, ok := p.parts[strings.ToUpper(partName)]
+	_, ok := p.parts[CanonicalPartName(partName)]
 	return ok
 }
 
@@ -46,7 +46,7 @@ func (p *pkg) add(part *Part) error {
 	if err := part.validate(); err != nil {
 		return err
 	}
-	upperURI := strings.ToUpper(part.Name)
+	upperURI := CanonicalPartName(part.Name)
 	if p.partExists(upperURI) {
 		return newError(112, part.Name)
 	}
@@ -55,34 +55,25 @@ func (p *pkg) add(part *Part) error {
 	}
 	p.contentTypes.add(part.Name, part.ContentType)
 	p.parts[upperURI] = part
+	p.index.add(upperURI)
 	return nil
 }
 
 func (p *pkg) deletePart(uri string) {
-	delete(p.parts, strings.ToUpper(uri))
+	name := CanonicalPartName(uri)
+	if _, ok := p.parts[name]; ok && p.index != nil {
+		p.index.remove(name)
+	}
+	delete(p.parts, name)
 }
 
+// checkPrefixCollision returns true if uri is derived from an existing part name, by appending segments to it, or vice versa.
+// uri shall be in canonical form.
 func (p *pkg) checkPrefixCollision(uri string) bool {
-	keys := make([]string, len(p.parts)+1)
-	keys[0] = uri
-	i := 1
-	for k := range p.parts {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-
-	for i, k := range keys {
-		if k == uri {
-			if i > 0 && p.checkStringsPrefixCollision(uri, keys[i-1]) {
-				return true
-			}
-			if i < len(keys)-1 && p.checkStringsPrefixCollision(keys[i+1], uri) {
-				return true
-			}
-		}
+	if p.index == nil || p.index.size != len(p.parts) {
+		p.index = newPartIndex(p.parts)
 	}
-	return false
+	return p.index.collides(uri)
 }
 
 func (p *pkg) encodeContentTypes(w io.Writer) error {
@@ -90,10 +81,6 @@ func (p *pkg) encodeContentTypes(w io.Writer) error {
 	return xml.NewEncoder(w).Encode(p.contentTypes.toXML())
 }
 
-func (p *pkg) checkStringsPrefixCollision(s1, s2 string) bool {
-	return strings.HasPrefix(s1, s2) && len(s1) > len(s2) && s1[len(s2)] == '/'
-}
-
 type contentTypesXML struct {
 	XMLName xml.Name      `xml:"Types"`
 	XML     string        `xml:"xmlns,attr"`
@@ -115,23 +102,30 @@ type overrideContentTypeXML struct {
 type contentTypes struct {
 	defaults  map[string]string // extension:contenttype
 	overrides map[string]string // partname:contenttype
+	names     map[string]string // canonical partname:partname as decoded, only set by decodeContentTypes
 }
 
 func (c *contentTypes) toXML() *contentTypesXML {
 	cx := &contentTypesXML{XML: "http://schemas.openxmlformats.org/package/2006/content-types"}
-	if c.defaults != nil {
-		for e, ct := range c.defaults {
-			cx.Types = append(cx.Types, &defaultContentTypeXML{Extension: e, ContentType: ct})
-		}
+	// Sort the entries so the output is deterministic
+	for _, e := range sortedKeys(c.defaults) {
+		cx.Types = append(cx.Types, &defaultContentTypeXML{Extension: e, ContentType: c.defaults[e]})
 	}
-	if c.overrides != nil {
-		for pn, ct := range c.overrides {
-			cx.Types = append(cx.Types, &overrideContentTypeXML{PartName: pn, ContentType: ct})
-		}
+	for _, pn := range sortedKeys(c.overrides) {
+		cx.Types = append(cx.Types, &overrideContentTypeXML{PartName: pn, ContentType: c.overrides[pn]})
 	}
 	return cx
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (c *contentTypes) ensureDefaultsMap() {
 	if c.defaults == nil {
 		c.defaults = make(map[string]string, 0)
@@ -182,7 +176,7 @@ func (c *contentTypes) addDefault(extension, contentType string) {
 }
 
 func (c *contentTypes) findType(name string) (string, error) {
-	if t, ok := c.overrides[strings.ToUpper(name)]; ok {
+	if t, ok := c.overrides[CanonicalPartName(name)]; ok {
 		return t, nil
 	}
 	ext := filepath.Ext(name)
@@ -195,47 +189,39 @@ func (c *contentTypes) findType(name string) (string, error) {
 }
 
 type corePropertiesXMLMarshal struct {
-	XMLName        xml.Name `xml:"coreProperties"`
-	XML            string   `xml:"xmlns,attr"`
-	XMLDCTERMS     string   `xml:"xmlns:dcterms,attr"`
-	XMLDC          string   `xml:"xmlns:dc,attr"`
-	Category       string   `xml:"category,omitempty"`
-	ContentStatus  string   `xml:"contentStatus,omitempty"`
-	Created        string   `xml:"dcterms:created,omitempty"`
-	Creator        string   `xml:"dc:creator,omitempty"`
-	Description    string   `xml:"dc:description,omitempty"`
-	Identifier     string   `xml:"dc:identifier,omitempty"`
-	Keywords       string   `xml:"keywords,omitempty"`
-	Language       string   `xml:"dc:language,omitempty"`
-	LastModifiedBy string   `xml:"lastModifiedBy,omitempty"`
-	LastPrinted    string   `xml:"lastPrinted,omitempty"`
-	Modified       string   `xml:"dcterms:modified,omitempty"`
-	Revision       string   `xml:"revision,omitempty"`
-	Subject        string   `xml:"dc:subject,omitempty"`
-	Title          string   `xml:"dc:title,omitempty"`
-	Version        string   `xml:"version,omitempty"`
+	XMLName        xml.Name   `xml:"coreProperties"`
+	XML            string     `xml:"xmlns,attr"`
+	XMLDCTERMS     string     `xml:"xmlns:dcterms,attr"`
+	XMLDC          string     `xml:"xmlns:dc,attr"`
+	XMLXSI         string     `xml:"xmlns:xsi,attr"`
+	Category       string     `xml:"category,omitempty"`
+	ContentStatus  string     `xml:"contentStatus,omitempty"`
+	Created        *w3cdtfXML `xml:"dcterms:created,omitempty"`
+	Creator        string     `xml:"dc:creator,omitempty"`
+	Description    string     `xml:"dc:description,omitempty"`
+	Identifier     string     `xml:"dc:identifier,omitempty"`
+	Keywords       string     `xml:"keywords,omitempty"`
+	Language       string     `xml:"dc:language,omitempty"`
+	LastModifiedBy string     `xml:"lastModifiedBy,omitempty"`
+	LastPrinted    string     `xml:"lastPrinted,omitempty"`
+	Modified       *w3cdtfXML `xml:"dcterms:modified,omitempty"`
+	Revision       string     `xml:"revision,omitempty"`
+	Subject        string     `xml:"dc:subject,omitempty"`
+	Title          string     `xml:"dc:title,omitempty"`
+	Version        string     `xml:"version,omitempty"`
 }
 
-type corePropertiesXMLUnmarshal struct {
-	XMLName        xml.Name `xml:"coreProperties"`
-	XML            string   `xml:"xmlns,attr"`
-	XMLDCTERMS     string   `xml:"dcterms,attr"`
-	XMLDC          string   `xml:"dc,attr"`
-	Category       string   `xml:"category,omitempty"`
-	ContentStatus  string   `xml:"contentStatus,omitempty"`
-	Created        string   `xml:"created,omitempty"`
-	Creator        string   `xml:"creator,omitempty"`
-	Description    string   `xml:"description,omitempty"`
-	Identifier     string   `xml:"identifier,omitempty"`
-	Keywords       string   `xml:"keywords,omitempty"`
-	Language       string   `xml:"language,omitempty"`
-	LastModifiedBy string   `xml:"lastModifiedBy,omitempty"`
-	LastPrinted    string   `xml:"lastPrinted,omitempty"`
-	Modified       string   `xml:"modified,omitempty"`
-	Revision       string   `xml:"revision,omitempty"`
-	Subject        string   `xml:"subject,omitempty"`
-	Title          string   `xml:"title,omitempty"`
-	Version        string   `xml:"version,omitempty"`
+// w3cdtfXML is a date element that shall be typed as dcterms:W3CDTF, as required by ISO/IEC 29500-2 M4.5.
+type w3cdtfXML struct {
+	Type  string `xml:"xsi:type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func newW3CDTF(value string) *w3cdtfXML {
+	if value == "" {
+		return nil
+	}
+	return &w3cdtfXML{Type: "dcterms:" + w3cdtfSimpleType, Value: value}
 }
 
 // CoreProperties enable users to get and set well-known and common sets of property metadata within packages.
@@ -262,27 +248,33 @@ func (c *CoreProperties) encode(w io.Writer) error {
 	w.Write(([]byte)(`<?xml version="1.0" encoding="UTF-8"?>`))
 	return xml.NewEncoder(w).Encode(&corePropertiesXMLMarshal{
 		xml.Name{Local: "coreProperties"},
-		"http://schemas.openxmlformats.org/package/2006/metadata/core-properties",
-		"http://purl.org/dc/terms/",
-		"http://purl.org/dc/elements/1.1/",
-		c.Category, c.ContentStatus, c.Created,
+		corePropsNS, dcTermsNS, dcNS, xsiNS,
+		c.Category, c.ContentStatus, newW3CDTF(c.Created),
 		c.Creator, c.Description, c.Identifier,
 		c.Keywords, c.Language, c.LastModifiedBy,
-		c.LastPrinted, c.Modified, c.Revision,
+		c.LastPrinted, newW3CDTF(c.Modified), c.Revision,
 		c.Subject, c.Title, c.Version,
 	})
 }
 
-func decodeCoreProperties(r io.Reader) (*CoreProperties, error) {
-	propDecode := new(corePropertiesXMLUnmarshal)
-	if err := xml.NewDecoder(r).Decode(propDecode); err != nil {
-		return nil, fmt.Errorf("opc: %s: cannot be decoded: %v", contentTypesName, err)
+func decodeCoreProperties(r io.Reader, partName string) (*CoreProperties, error) {
+	propDecode := new(xmlNode)
+	if err := newXMLDecoder(r, partName).Decode(propDecode); err != nil {
+		return nil, decodeError(partName, err)
+	}
+	if err := validateCorePropertiesSchema(propDecode, partName); err != nil {
+		return nil, err
+	}
+	prop := new(CoreProperties)
+	fields := map[string]*string{
+		"category": &prop.Category, "contentStatus": &prop.ContentStatus, "created": &prop.Created,
+		"creator": &prop.Creator, "description": &prop.Description, "identifier": &prop.Identifier,
+		"keywords": &prop.Keywords, "language": &prop.Language, "lastModifiedBy": &prop.LastModifiedBy,
+		"lastPrinted": &prop.LastPrinted, "modified": &prop.Modified, "revision": &prop.Revision,
+		"subject": &prop.Subject, "title": &prop.Title, "version": &prop.Version,
+	}
+	for _, c := range propDecode.Children {
+		*fields[c.XMLName.Local] = c.Text
 	}
-	prop := &CoreProperties{Category: propDecode.Category, ContentStatus: propDecode.ContentStatus,
-		Created: propDecode.Created, Creator: propDecode.Creator, Description: propDecode.Description,
-		Identifier: propDecode.Identifier, Keywords: propDecode.Keywords, Language: propDecode.Language,
-		LastModifiedBy: propDecode.LastModifiedBy, LastPrinted: propDecode.LastPrinted, Modified: propDecode.Modified,
-		Revision: propDecode.Revision, Subject: propDecode.Subject, Title: propDecode.Title, Version: propDecode.Version}
-
 	return prop, nil
 }
@@ -10,7 +10,7 @@ import (
 func createFakePackage(m ...string) *pkg {
 	parts := make(map[string]*Part, len(m))
 	for _, s := range m {
-		parts[strings.ToUpper(s)] = new(Part)
+		parts[CanonicalPartName(s)] = new(Part)
 	}
 	return &pkg{
 		parts: parts,
@@ -69,10 +69,12 @@ func TestPackage_add(t *testing.T) {
 		wantContentTypes contentTypes
 		wantErr          bool
 	}{
-		{"base", createFakePackage("/b.xml"), args{&Part{"/A.xml", "a/b", nil}}, contentTypes{map[string]string{"xml": "a/b"}, nil}, false},
+		{"base", createFakePackage("/b.xml"), args{&Part{"/A.xml", "a/b", nil}}, contentTypes{defaults: map[string]string{"xml": "a/b"}}, false},
 		{"emptyContentType", createFakePackage(), args{&Part{"/A.xml", "", nil}}, contentTypes{}, true},
-		{"noExtension", createFakePackage(), args{&Part{"/A", "a/b", nil}}, contentTypes{nil, map[string]string{"/A": "a/b"}}, false},
+		{"noExtension", createFakePackage(), args{&Part{"/A", "a/b", nil}}, contentTypes{overrides: map[string]string{"/A": "a/b"}}, false},
 		{"duplicated", createFakePackage("/a.xml"), args{&Part{"/A.xml", "a/b", nil}}, contentTypes{}, true},
+		{"duplicatedEncoded", createFakePackage("/%c3%a9.xml"), args{&Part{"/%C3%A9.xml", "a/b", nil}}, contentTypes{}, true},
+		{"notDuplicatedNonASCIICase", createFakePackage("/%C3%89.xml"), args{&Part{"/%C3%A9.xml", "a/b", nil}}, contentTypes{defaults: map[string]string{"xml": "a/b"}}, false},
 		{"collision1", createFakePackage("/abc.xml", "/xyz/PQR/A.JPG"), args{&Part{"/abc.xml/b.xml", "a/b", nil}}, contentTypes{}, true},
 		{"collision2", createFakePackage("/abc.xml", "/xyz/PQR/A.JPG"), args{&Part{"/xyz/pqr", "a/b", nil}}, contentTypes{}, true},
 	}
@@ -92,7 +94,7 @@ func TestPackage_add(t *testing.T) {
 func buildCoreString(content string) string {
 	s := `<?xml version="1.0" encoding="UTF-8"?>`
 	s += `<coreProperties xmlns="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"`
-	s += ` xmlns:dcterms="http://purl.org/dc/terms/" xmlns:dc="http://purl.org/dc/elements/1.1/">`
+	s += ` xmlns:dcterms="http://purl.org/dc/terms/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`
 	return s + content + "</coreProperties>"
 }
 
@@ -106,7 +108,7 @@ func TestCoreProperties_encode(t *testing.T) {
 		{"empty", &CoreProperties{}, buildCoreString(""), false},
 		{"some", &CoreProperties{Category: "A", LastPrinted: "b"}, buildCoreString("<category>A</category><lastPrinted>b</lastPrinted>"), false},
 		{"all", &CoreProperties{"partName", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o"},
-			buildCoreString("<category>a</category><contentStatus>b</contentStatus><dcterms:created>c</dcterms:created><dc:creator>d</dc:creator><dc:description>e</dc:description><dc:identifier>f</dc:identifier><keywords>g</keywords><dc:language>h</dc:language><lastModifiedBy>i</lastModifiedBy><lastPrinted>j</lastPrinted><dcterms:modified>k</dcterms:modified><revision>l</revision><dc:subject>m</dc:subject><dc:title>n</dc:title><version>o</version>"),
+			buildCoreString("<category>a</category><contentStatus>b</contentStatus><dcterms:created xsi:type=\"dcterms:W3CDTF\">c</dcterms:created><dc:creator>d</dc:creator><dc:description>e</dc:description><dc:identifier>f</dc:identifier><keywords>g</keywords><dc:language>h</dc:language><lastModifiedBy>i</lastModifiedBy><lastPrinted>j</lastPrinted><dcterms:modified xsi:type=\"dcterms:W3CDTF\">k</dcterms:modified><revision>l</revision><dc:subject>m</dc:subject><dc:title>n</dc:title><version>o</version>"),
 			false},
 	}
 	for _, tt := range tests {
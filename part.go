@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"mime"
 	"net/url"
-	"path/filepath"
+	"path"
 	"strings"
 )
 
@@ -34,13 +34,87 @@ var defaultRef, _ = url.Parse("http://defaultcontainer/")
 // This method should be used in places where we have a target relationship URI and we want to get the
 // name of the part it targets with respect to the source part.
 // The source can be a valid part URI, for part relationships, or "/", for package relationships.
+// It returns an empty string if the target cannot be resolved, use ResolveRelationshipTarget to get the reason.
 func ResolveRelationship(source string, rel string) string {
-	if source == "/" || source == "\\" {
-		return "/" + rel
+	name, _ := ResolveRelationshipTarget(source, rel)
+	return name
+}
+
+// ResolveRelationshipTarget is like ResolveRelationship but it returns an error if rel cannot be resolved.
+// The resolution follows RFC 3986 §5.2: dot segments are removed and the fragment and query components,
+// which are not part of a part name, are discarded. The result is normalized with NormalizePartName.
+// An error is returned if rel is not a valid relative reference or if it goes above the package root.
+func ResolveRelationshipTarget(source string, rel string) (string, error) {
+	source = strings.Replace(source, "\\", "/", -1)
+	rel = strings.Replace(rel, "\\", "/", -1)
+	if source == "" || source[0] != '/' {
+		source = "/" + source
+	}
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("opc: %s: invalid source url: %v", source, err)
+	}
+	relURL, err := url.Parse(rel)
+	if err != nil {
+		return "", newError(128, source)
+	}
+	if relURL.IsAbs() || relURL.Host != "" {
+		return "", newError(129, source)
+	}
+	if escapesRoot(sourceURL.Path, relURL.Path) {
+		return "", newError(130, source)
 	}
-	if !strings.HasPrefix(rel, "/") && !strings.HasPrefix(rel, "\\") {
-		sourceDir := strings.Replace(filepath.Dir(source), "\\", "/", -1)
-		return fmt.Sprintf("%s/%s", sourceDir, rel)
+	resolved := sourceURL.ResolveReference(&url.URL{Path: relURL.Path, RawPath: relURL.RawPath})
+	if resolved.Path == "/" || resolved.Path == "" {
+		return "/", nil
+	}
+	return NormalizePartName(resolved.EscapedPath()), nil
+}
+
+// escapesRoot returns true if resolving the relative path against the base path
+// removes more segments than available, as url.ResolveReference silently ignores them.
+func escapesRoot(base, rel string) bool {
+	var depth int
+	if !strings.HasPrefix(rel, "/") {
+		depth = strings.Count(base, "/") - 1 // the last segment is not a directory
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		switch seg {
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		case ".", "":
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+// RelativeTarget returns the shortest relative reference that, resolved against the source part, points to the target part.
+// It is the reverse of ResolveRelationshipTarget and can be used to set the TargetURI of internal relationships.
+// The source can be a valid part URI, for part relationships, or "/", for package relationships.
+func RelativeTarget(source, target string) string {
+	sourceDir := strings.Split(strings.Trim(path.Dir(path.Clean("/"+source)), "/"), "/")
+	targetSegs := strings.Split(strings.Trim(path.Clean("/"+target), "/"), "/")
+	if source == "/" || sourceDir[0] == "" {
+		sourceDir = sourceDir[:0]
+	}
+	common := 0
+	for common < len(sourceDir) && common < len(targetSegs)-1 && sourceDir[common] == targetSegs[common] {
+		common++
+	}
+	var b strings.Builder
+	for i := common; i < len(sourceDir); i++ {
+		b.WriteString("../")
+	}
+	b.WriteString(strings.Join(targetSegs[common:], "/"))
+	rel := b.String()
+	// A first segment containing a colon would be parsed as a scheme
+	if first := strings.SplitN(rel, "/", 2)[0]; strings.Contains(first, ":") {
+		rel = "./" + rel
 	}
 	return rel
 }
@@ -53,6 +127,8 @@ func ResolveRelationship(source string, rel string) string {
 //     unreserved = ALPHA / DIGIT / "-" / "." / "_" / "~"
 //     pct-encoded = "%" HEXDIG HEXDIG
 //     sub-delims = "!" / "$" / "&" / "'" / "(" / ")" / "*" / "+" / "," / ";" / "="
+// The name can also be an IRI, as defined in RFC 3987, in which case it is converted to a URI
+// by percent-encoding the UTF-8 octets of the non-ASCII characters.
 // This method is recommended to be used before adding a new Part to a package to avoid errors.
 // If, for whatever reason, the name can't be adapted to the specs, the return value will be the same as the original.
 // Warning: This method can heavily modify the original if it differs a lot from the specs, which could led to duplicated part names.
@@ -61,7 +137,7 @@ func NormalizePartName(name string) string {
 		return name
 	}
 
-	normalized := strings.Replace(name, "\\", "/", -1)
+	normalized := strings.Replace(iriToURI(name), "\\", "/", -1)
 	normalized = strings.Replace(normalized, "//", "/", -1)
 	normalized = strings.Replace(normalized, "%2e", ".", -1)
 	if strings.HasSuffix(normalized, "/") {
@@ -81,6 +157,50 @@ func NormalizePartName(name string) string {
 	return p.EscapedPath()
 }
 
+// PartNamesEquivalent reports whether a and b are equivalent part names as defined in ISO/IEC 29500-2 §9.1.1.2,
+// that is, if their canonical forms are equal.
+// A package shall not contain equivalent part names.
+func PartNamesEquivalent(a, b string) bool {
+	return a == b || CanonicalPartName(a) == CanonicalPartName(b)
+}
+
+// CanonicalPartName returns the form of name used to compare part names, as described in ISO/IEC 29500-2 §9.1.1.2.
+// Part names are compared as case-insensitive ASCII strings once they have been normalized as follows:
+//     - Non-ASCII characters are percent-encoded, as an IRI is converted to a URI in RFC 3987 §3.1.
+//     - Percent-encoded unreserved characters are decoded, as described in RFC 3986 §6.2.2.2.
+//     - ASCII letters, including the hexadecimal digits of the percent-encoded octets, are upper-cased.
+// Non-ASCII letters are not case-folded, so "/é.xml" and "/É.xml" are not equivalent.
+func CanonicalPartName(name string) string {
+	name = iriToURI(name)
+	b := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '%' && i+2 < len(name) && isHex(name[i+1]) && isHex(name[i+2]) {
+			d := unhex(name[i+1])<<4 | unhex(name[i+2])
+			if isUnreserved(d) {
+				b = append(b, upperASCII(d))
+			} else {
+				b = append(b, '%', upperASCII(name[i+1]), upperASCII(name[i+2]))
+			}
+			i += 2
+			continue
+		}
+		b = append(b, upperASCII(c))
+	}
+	return string(b)
+}
+
+func upperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func isUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
 func (p *Part) validateContentType() error {
 	if strings.TrimSpace(p.ContentType) == "" {
 		return newError(102, p.Name)
@@ -0,0 +1,79 @@
+package opc
+
+import "strings"
+
+// partIndex is a trie over the segments of canonical part names.
+// It is used to detect equivalent part names and part names derived from other part names
+// in a time proportional to the number of segments instead of the number of parts.
+type partIndex struct {
+	root indexNode
+	size int
+}
+
+type indexNode struct {
+	children map[string]*indexNode
+	part     bool // true if the node is the last segment of a part name
+}
+
+func newPartIndex(names map[string]*Part) *partIndex {
+	x := new(partIndex)
+	for name := range names {
+		x.add(name)
+	}
+	return x
+}
+
+// collides returns true if name is derived from an indexed part name, by appending segments to it, or vice versa.
+func (x *partIndex) collides(name string) bool {
+	n := &x.root
+	for _, seg := range strings.Split(strings.TrimPrefix(name, "/"), "/") {
+		if n.part {
+			return true
+		}
+		if n = n.children[seg]; n == nil {
+			return false
+		}
+	}
+	return len(n.children) > 0
+}
+
+func (x *partIndex) add(name string) {
+	n := &x.root
+	for _, seg := range strings.Split(strings.TrimPrefix(name, "/"), "/") {
+		child := n.children[seg]
+		if child == nil {
+			if n.children == nil {
+				n.children = make(map[string]*indexNode, 1)
+			}
+			child = new(indexNode)
+			n.children[seg] = child
+		}
+		n = child
+	}
+	if !n.part {
+		n.part = true
+		x.size++
+	}
+}
+
+func (x *partIndex) remove(name string) {
+	segs := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	path := make([]*indexNode, 0, len(segs)+1)
+	n := &x.root
+	for _, seg := range segs {
+		path = append(path, n)
+		if n = n.children[seg]; n == nil {
+			return
+		}
+	}
+	if !n.part {
+		return
+	}
+	n.part = false
+	x.size--
+	// Prune the nodes that do not lead to any part
+	for i := len(segs) - 1; i >= 0 && !n.part && len(n.children) == 0; i-- {
+		delete(path[i].children, segs[i])
+		n = path[i]
+	}
+}
@@ -0,0 +1,59 @@
+package opc
+
+import (
+	"testing"
+)
+
+func Test_partIndex(t *testing.T) {
+	x := newPartIndex(map[string]*Part{"/ABC.XML": nil, "/XYZ/PQR/A.JPG": nil})
+	tests := []struct {
+		name string
+		uri  string
+		want bool
+	}{
+		{"notIndexed", "/B.XML", false},
+		{"sameFolder", "/XYZ/PQR/B.JPG", false},
+		{"prefixNotSegment", "/ABC.XMLS", false},
+		{"derived", "/ABC.XML/B.XML", true},
+		{"deepDerived", "/XYZ/PQR/A.JPG/B/C", true},
+		{"parent", "/XYZ/PQR", true},
+		{"grandParent", "/XYZ", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := x.collides(tt.uri); got != tt.want {
+				t.Errorf("partIndex.collides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_partIndex_remove(t *testing.T) {
+	x := newPartIndex(map[string]*Part{"/A/B.XML": nil, "/A/C/D.XML": nil})
+	x.remove("/A/C/D.XML")
+	x.remove("/A/NOTEXISTS.XML")
+	x.remove("/A")
+	if x.size != 1 {
+		t.Errorf("partIndex.size = %v, want 1", x.size)
+	}
+	if x.collides("/A/C") {
+		t.Error("partIndex.collides() should not detect removed parts")
+	}
+	if !x.collides("/A") {
+		t.Error("partIndex.collides() should detect existing parts")
+	}
+	if _, ok := x.root.children["A"].children["C"]; ok {
+		t.Error("partIndex.remove() should prune empty nodes")
+	}
+}
+
+func TestPackage_addAfterDelete(t *testing.T) {
+	p := newPackage()
+	if err := p.add(&Part{Name: "/a.xml", ContentType: "a/b"}); err != nil {
+		t.Fatal(err)
+	}
+	p.deletePart("/A.XML")
+	if err := p.add(&Part{Name: "/a.xml/b.xml", ContentType: "a/b"}); err != nil {
+		t.Errorf("pkg.add() error = %v, want nil", err)
+	}
+}
@@ -41,6 +41,9 @@ func TestNormalizePartName(t *testing.T) {
 		{"fromSpec11", args{"\\%41.xml"}, "/A.xml"},
 		{"fromSpec12", args{"/%D1%86.xml"}, "/%D1%86.xml"},
 		{"fromSpec13", args{"\\%2e/a.xml"}, "/a.xml"},
+		{"iri", args{"/docs/résumé.xml"}, "/docs/r%C3%A9sum%C3%A9.xml"},
+		{"iriMixed", args{"/docs/résumé%20a.xml"}, "/docs/r%C3%A9sum%C3%A9%20a.xml"},
+		{"iriLowerHex", args{"/docs/r%c3%a9sum%c3%a9.xml"}, "/docs/r%C3%A9sum%C3%A9.xml"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -101,27 +104,135 @@ func TestPart_validate(t *testing.T) {
 	}
 }
 
-func TestResolveRelationship(t *testing.T) {
+func TestResolveRelationshipTarget(t *testing.T) {
 	type args struct {
 		source string
 		rel    string
 	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"package", args{"/", "c.xml"}, "/c.xml", false},
+		{"packageWin", args{"\\", "c.xml"}, "/c.xml", false},
+		{"packageAbs", args{"/", "/c.xml"}, "/c.xml", false},
+		{"rel", args{"/3D/3dmodel.model", "c.xml"}, "/3D/c.xml", false},
+		{"rel", args{"/3D/3dmodel.model", "/3D/box1.model"}, "/3D/box1.model", false},
+		{"rel", args{"/3D/box3.model", "/2D/2dmodel.model"}, "/2D/2dmodel.model", false},
+		{"relChild", args{"/3D/box3.model", "2D/2dmodel.model"}, "/3D/2D/2dmodel.model", false},
+		{"parent", args{"/word/document.xml", "../media/a.png"}, "/media/a.png", false},
+		{"dot", args{"/word/document.xml", "./media/./a.png"}, "/word/media/a.png", false},
+		{"parentInside", args{"/a/b/c.xml", "d/../../e.xml"}, "/a/e.xml", false},
+		{"fragment", args{"/word/document.xml", "media/a.xml#b"}, "/word/media/a.xml", false},
+		{"query", args{"/word/document.xml", "media/a.xml?b=c"}, "/word/media/a.xml", false},
+		{"onlyFragment", args{"/word/document.xml", "#b"}, "/word/document.xml", false},
+		{"escaped", args{"/word/document.xml", "media/%41%20b.png"}, "/word/media/A%20b.png", false},
+		{"iri", args{"/word/document.xml", "media/é.png"}, "/word/media/%C3%A9.png", false},
+		{"aboveRoot", args{"/", "../a.png"}, "", true},
+		{"aboveRootPart", args{"/word/document.xml", "../../a.png"}, "", true},
+		{"aboveRootAbs", args{"/word/document.xml", "/../a.png"}, "", true},
+		{"absURI", args{"/word/document.xml", "http://a.com/a.png"}, "", true},
+		{"networkPath", args{"/word/document.xml", "//a.com/a.png"}, "", true},
+		{"invalid", args{"/word/document.xml", "%"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveRelationshipTarget(tt.args.source, tt.args.rel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveRelationshipTarget() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRelationshipTarget() = %v, want %v", got, tt.want)
+			}
+			if got := ResolveRelationship(tt.args.source, tt.args.rel); got != tt.want {
+				t.Errorf("ResolveRelationship() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	_, err := ResolveRelationshipTarget("/word/document.xml", "../../a.png")
+	checkErrorCode(t, "ResolveRelationshipTarget()", err, 130)
+}
+
+func TestRelativeTarget(t *testing.T) {
+	type args struct {
+		source string
+		target string
+	}
 	tests := []struct {
 		name string
 		args args
 		want string
 	}{
-		{"package", args{"/", "c.xml"}, "/c.xml"},
-		{"packageWin", args{"\\", "c.xml"}, "/c.xml"},
-		{"rel", args{"/3D/3dmodel.model", "c.xml"}, "/3D/c.xml"},
-		{"rel", args{"/3D/3dmodel.model", "/3D/box1.model"}, "/3D/box1.model"},
-		{"rel", args{"/3D/box3.model", "/2D/2dmodel.model"}, "/2D/2dmodel.model"},
-		{"relChild", args{"/3D/box3.model", "2D/2dmodel.model"}, "/3D/2D/2dmodel.model"},
+		{"package", args{"/", "/word/document.xml"}, "word/document.xml"},
+		{"sameDir", args{"/word/document.xml", "/word/styles.xml"}, "styles.xml"},
+		{"self", args{"/word/document.xml", "/word/document.xml"}, "document.xml"},
+		{"child", args{"/word/document.xml", "/word/media/a.png"}, "media/a.png"},
+		{"parent", args{"/word/document.xml", "/media/a.png"}, "../media/a.png"},
+		{"sibling", args{"/a/b/c.xml", "/a/d/e.xml"}, "../d/e.xml"},
+		{"root", args{"/a/b/c.xml", "/e.xml"}, "../../e.xml"},
+		{"colon", args{"/a.xml", "/b:c.xml"}, "./b:c.xml"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := ResolveRelationship(tt.args.source, tt.args.rel); got != tt.want {
-				t.Errorf("ResolveRelationship() = %v, want %v", got, tt.want)
+			got := RelativeTarget(tt.args.source, tt.args.target)
+			if got != tt.want {
+				t.Errorf("RelativeTarget() = %v, want %v", got, tt.want)
+			}
+			if resolved, err := ResolveRelationshipTarget(tt.args.source, got); err != nil || resolved != tt.args.target {
+				t.Errorf("ResolveRelationshipTarget(RelativeTarget()) = %v, %v, want %v", resolved, err, tt.args.target)
+			}
+		})
+	}
+}
+
+func TestPartNamesEquivalent(t *testing.T) {
+	type args struct {
+		a string
+		b string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"equal", args{"/a.xml", "/a.xml"}, true},
+		{"asciiCase", args{"/docs/a.xml", "/DOCS/A.XML"}, true},
+		{"hexCase", args{"/%c3%a9.xml", "/%C3%A9.xml"}, true},
+		{"iri", args{"/%C3%A9.xml", "/é.xml"}, true},
+		{"nonASCIICase", args{"/%C3%A9.xml", "/É.xml"}, false},
+		{"nonASCIICaseIRI", args{"/é.xml", "/É.xml"}, false},
+		{"unreservedEncoded", args{"/%41%7E.xml", "/a~.xml"}, true},
+		{"reservedEncoded", args{"/%21.xml", "/!.xml"}, false},
+		{"different", args{"/a.xml", "/b.xml"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PartNamesEquivalent(tt.args.a, tt.args.b); got != tt.want {
+				t.Errorf("PartNamesEquivalent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalPartName(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"base", "/docs/a.xml", "/DOCS/A.XML"},
+		{"percent", "/%c3%a9%2f.xml", "/%C3%A9%2F.XML"},
+		{"iri", "/é.xml", "/%C3%A9.XML"},
+		{"unreserved", "/%7e%2D.xml", "/~-.XML"},
+		{"invalidPercent", "/%zz.xml", "/%ZZ.XML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanonicalPartName(tt.arg); got != tt.want {
+				t.Errorf("CanonicalPartName() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -2,23 +2,25 @@ package opc
 
 import (
 	"archive/zip"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"path"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-type archiveFile interface {
-	Open() (io.ReadCloser, error)
-	Name() string
-	Size() int
+// seekableFile is implemented by the archive files that support random access.
+type seekableFile interface {
+	OpenSeeker() (ReadSeekerAt, error)
 }
 
-type archive interface {
-	Files() []archiveFile
-	RegisterDecompressor(method uint16, dcomp func(r io.Reader) io.ReadCloser)
+// ReadSeekerAt is the interface that groups the io.ReadSeeker and io.ReaderAt interfaces.
+type ReadSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
 }
 
 // ReadCloser wrapps a Reader than can be closed.
@@ -47,17 +49,98 @@ func (r *ReadCloser) Close() error {
 	return r.f.Close()
 }
 
+// RelationshipsLoading defines when the relationship parts are decoded.
+type RelationshipsLoading int
+
+const (
+	// LoadSequential decodes the relationship parts one after the other when opening the package.
+	LoadSequential RelationshipsLoading = iota
+	// LoadLazy decodes the relationship parts of a part the first time File.LoadRelationships is called.
+	// Relationship parts whose source part does not exist are decoded when opening the package.
+	LoadLazy
+	// LoadParallel decodes the relationship parts concurrently when opening the package.
+	// ArchiveFile.Open is called from multiple goroutines, so custom archives shall support concurrent opens.
+	LoadParallel
+)
+
+// ReaderOptions configures how a Reader loads a package.
+type ReaderOptions struct {
+	Relationships RelationshipsLoading // When the relationship parts are decoded.
+	Concurrency   int                  // Maximum number of goroutines used by LoadParallel. If zero runtime.GOMAXPROCS is used.
+	Limits        ReaderLimits         // Resources that can be consumed, a LimitError is returned when one is exceeded. No limits by default.
+}
+
 // File is used to read a part from the OPC package.
 type File struct {
 	*Part
-	Size int
-	a    archiveFile
+	Size    int
+	a       ArchiveFile
+	index   atomic.Value // *SeekIndex, set concurrently with OpenSeeker
+	rels    *lazyRelationships
+	limited bool // Open fails if the content is bigger than Size
+}
+
+type lazyRelationships struct {
+	once   sync.Once
+	file   ArchiveFile
+	limits *ReaderLimits
+	err    error
+}
+
+// LoadRelationships returns the relationships of the part.
+// When using LoadLazy the relationships part is decoded and validated the first time it is called,
+// with the same validations applied when the relationships are loaded with the package,
+// the result is stored in the Relationships field.
+// Otherwise the relationships have already been loaded when opening the package.
+// It is safe to call LoadRelationships concurrently.
+func (f *File) LoadRelationships() ([]*Relationship, error) {
+	if f.rels == nil {
+		return f.Relationships, nil
+	}
+	f.rels.once.Do(func() {
+		var rls []*Relationship
+		if rls, f.rels.err = decodeRelationshipsFile(f.rels.file, f.rels.limits); f.rels.err != nil {
+			return
+		}
+		if f.rels.err = validateRelationships(f.Name, rls); f.rels.err == nil {
+			f.Relationships = rls
+		}
+	})
+	return f.Relationships, f.rels.err
 }
 
 // Open returns a ReadCloser that provides access to the File's contents.
 // Multiple files may be read concurrently.
+// When the Reader has limits the ReadCloser fails with a LimitError
+// if the content is bigger than Size, which has already been checked against the limits.
 func (f *File) Open() (io.ReadCloser, error) {
-	return f.a.Open()
+	rc, err := f.a.Open()
+	if err != nil || !f.limited {
+		return rc, err
+	}
+	return newLimitedReadCloser(rc, f.Name, "part size", int64(f.Size)), nil
+}
+
+// OpenSeeker returns a ReadSeekerAt that provides random access to the File's contents
+// without reading it from the beginning.
+// It is supported for the parts stored without compression,
+// and for the deflated parts that have a SeekIndex, see BuildSeekIndex and SetSeekIndex.
+// It reads directly from the io.ReaderAt passed to NewReader.
+// Multiple files may be read concurrently.
+func (f *File) OpenSeeker() (ReadSeekerAt, error) {
+	if idx, _ := f.index.Load().(*SeekIndex); idx != nil {
+		if df, ok := f.a.(deflatedFile); ok {
+			sr, _, err := df.openDeflated()
+			if err != nil {
+				return nil, err
+			}
+			return newIndexedReader(f.Name, sr, idx), nil
+		}
+	}
+	if sf, ok := f.a.(seekableFile); ok {
+		return sf.OpenSeeker()
+	}
+	return nil, fmt.Errorf("opc: %s: cannot be opened for random access", f.Name)
 }
 
 // Reader implements a OPC file reader.
@@ -66,7 +149,10 @@ type Reader struct {
 	Relationships []*Relationship
 	Properties    CoreProperties
 	p             *pkg
-	r             archive
+	r             Archive
+	opts          ReaderOptions
+	fsOnce        sync.Once
+	fsys          *fsIndex
 }
 
 // NewReader returns a new Reader reading an OPC file to r.
@@ -78,35 +164,107 @@ func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
 	return newReader(zr)
 }
 
+// NewReaderWithOptions returns a new Reader reading an OPC file to r using the given options.
+func NewReaderWithOptions(r io.ReaderAt, size int64, opts ReaderOptions) (*Reader, error) {
+	zr, err := newZipReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return newReaderWithOptions(zr, opts)
+}
+
+// NewReaderFromArchive returns a new Reader reading an OPC package stored in a, using the given options.
+// It applies the same validations as NewReader, only the physical mapping is provided by a.
+func NewReaderFromArchive(a Archive, opts ReaderOptions) (*Reader, error) {
+	return newReaderWithOptions(a, opts)
+}
+
 // newReader returns a new Reader reading an OPC file to r.
-func newReader(a archive) (*Reader, error) {
-	r := &Reader{p: newPackage(), r: a}
+func newReader(a Archive) (*Reader, error) {
+	return newReaderWithOptions(a, ReaderOptions{})
+}
+
+func newReaderWithOptions(a Archive, opts ReaderOptions) (*Reader, error) {
+	r := &Reader{p: newPackage(), r: a, opts: opts}
 	if err := r.loadPackage(); err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
+// File returns the part with the given name, which is compared to the part names
+// using the equivalence defined in ISO/IEC 29500-2 §9.1.1.2, so "/WORD/document.xml" finds "/word/document.xml".
+// Files is indexed the first time File or the fs.FS methods are called, later changes to it are not seen.
+func (r *Reader) File(name string) (*File, bool) {
+	f, ok := r.fsIndex().files[CanonicalPartName(name)]
+	return f, ok
+}
+
+// OpenPart opens the part with the given name, matched as in File.
+// Unlike Open, which implements fs.FS and takes names without the leading slash,
+// name is a part name such as "/word/document.xml".
+func (r *Reader) OpenPart(name string) (io.ReadCloser, error) {
+	f, ok := r.File(name)
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return f.Open()
+}
+
+// FilesByContentType returns the parts whose content type is contentType, compared case-insensitively,
+// in the same order as Files.
+func (r *Reader) FilesByContentType(contentType string) []*File {
+	var files []*File
+	for _, f := range r.Files {
+		if strings.EqualFold(f.ContentType, contentType) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// GlobFiles returns the parts whose name matches pattern, in the same order as Files.
+// The pattern syntax is the one of path.Match and it shall start with a slash, such as "/word/media/*.png".
+// The only possible returned error is path.ErrBadPattern.
+func (r *Reader) GlobFiles(pattern string) ([]*File, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var files []*File
+	for _, f := range r.Files {
+		if ok, _ := path.Match(pattern, f.Name); ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
 // SetDecompressor sets or overrides a custom decompressor for the DEFLATE.
+// It has no effect if the Archive does not support compression.
 func (r *Reader) SetDecompressor(dcomp func(r io.Reader) io.ReadCloser) {
-	r.r.RegisterDecompressor(zip.Deflate, dcomp)
+	if d, ok := r.r.(decompressorRegisterer); ok {
+		d.RegisterDecompressor(zip.Deflate, dcomp)
+	}
 }
 
 func (r *Reader) loadPackage() error {
-	ct, rels, err := r.loadPartProperties()
+	files := r.r.Files()
+	if err := r.opts.Limits.checkArchive(files); err != nil {
+		return err
+	}
+	ct, rels, err := r.loadPartProperties(files)
 	if err != nil {
 		return err
 	}
-	files := r.r.Files()
 	r.Files = make([]*File, 0, len(files)-1) // -1 is for [Content_Types].xml
 
 	for _, file := range files {
-		fileName := "/" + file.Name()
+		fileName := partNameFromZip(file.Name())
 		// skip content types part, relationship parts and directories
-		if strings.EqualFold(fileName, contentTypesName) || isRelationshipURI(fileName) || strings.HasSuffix(fileName, "/") {
+		if PartNamesEquivalent(fileName, contentTypesName) || isRelationshipURI(fileName) || strings.HasSuffix(fileName, "/") {
 			continue
 		}
-		if strings.EqualFold(fileName, r.Properties.PartName) {
+		if PartNamesEquivalent(fileName, r.Properties.PartName) {
 			cp, err := r.loadCoreProperties(file)
 			if err != nil {
 				return err
@@ -118,7 +276,11 @@ func (r *Reader) loadPackage() error {
 				return err
 			}
 			part := &Part{Name: fileName, ContentType: cType, Relationships: rels.findRelationship(fileName)}
-			r.Files = append(r.Files, &File{part, file.Size(), file})
+			f := &File{Part: part, Size: file.Size(), a: file, limited: r.opts.Limits.enabled()}
+			if relsFile, ok := rels.files[CanonicalPartName(fileName)]; ok {
+				f.rels = &lazyRelationships{file: relsFile, limits: &r.opts.Limits}
+			}
+			r.Files = append(r.Files, f)
 			if err = r.p.add(part); err != nil {
 				return err
 			}
@@ -128,135 +290,207 @@ func (r *Reader) loadPackage() error {
 	return nil
 }
 
-func (r *Reader) loadPartProperties() (*contentTypes, *relationshipsPart, error) {
+func (r *Reader) loadPartProperties(files []ArchiveFile) (*contentTypes, *relationshipsPart, error) {
 	var ct *contentTypes
 	rels := new(relationshipsPart)
-	for _, file := range r.r.Files() {
-		var err error
-		name := "/" + file.Name()
-		if strings.EqualFold(name, contentTypesName) {
+	var pending []int // relationship parts not loaded sequentially
+	var err error
+	for i, file := range files {
+		name := partNameFromZip(file.Name())
+		if PartNamesEquivalent(name, contentTypesName) {
 			ct, err = r.loadContentType(file)
 		} else if isRelationshipURI(name) {
-			if strings.EqualFold(name, packageRelName) {
+			if PartNamesEquivalent(name, packageRelName) {
 				err = r.loadPackageRelationships(file)
+			} else if r.opts.Relationships == LoadSequential {
+				err = loadRelationships(file, rels, &r.opts.Limits)
 			} else {
-				err = loadRelationships(file, rels)
+				pending = append(pending, i)
 			}
 		}
 		if err != nil {
-			return nil, nil, err
+			break
 		}
 	}
+	switch r.opts.Relationships {
+	case LoadLazy:
+		// The relationship parts without a File are decoded now, as nothing would decode them later,
+		// and their errors take precedence as they precede the sequential error.
+		parts := r.filePartNames(files)
+		for _, i := range pending {
+			source := relationshipsSource(partNameFromZip(files[i].Name()))
+			if _, ok := parts[CanonicalPartName(source)]; ok {
+				rels.addFile(source, files[i])
+			} else if lerr := loadRelationships(files[i], rels, &r.opts.Limits); lerr != nil {
+				err = lerr
+				break
+			}
+		}
+	case LoadParallel:
+		// The errors of the parts preceding the sequential error take precedence,
+		// so the result is the same as when loading sequentially.
+		if perr := loadRelationshipsParallel(files, pending, rels, r.opts.Concurrency, &r.opts.Limits); perr != nil {
+			err = perr
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
 	if ct == nil {
 		return nil, nil, newError(310, "/")
 	}
 	return ct, rels, nil
 }
 
-func (r *Reader) loadContentType(file archiveFile) (*contentTypes, error) {
+// filePartNames returns the canonical names of the archive files that are loaded as a File.
+func (r *Reader) filePartNames(files []ArchiveFile) map[string]struct{} {
+	names := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		name := partNameFromZip(file.Name())
+		if PartNamesEquivalent(name, contentTypesName) || isRelationshipURI(name) || strings.HasSuffix(name, "/") ||
+			PartNamesEquivalent(name, r.Properties.PartName) {
+			continue
+		}
+		names[CanonicalPartName(name)] = struct{}{}
+	}
+	return names
+}
+
+func (r *Reader) loadContentType(file ArchiveFile) (*contentTypes, error) {
 	// Process descrived in ISO/IEC 29500-2 §10.1.2.4
-	reader, err := file.Open()
+	reader, err := r.opts.Limits.openXML(file, contentTypesName)
 	if err != nil {
-		return nil, fmt.Errorf("opc: %s: cannot be opened: %v", contentTypesName, err)
+		return nil, err
 	}
+	defer reader.Close()
 	return decodeContentTypes(reader)
 }
 
-func (r *Reader) loadCoreProperties(file archiveFile) (*CoreProperties, error) {
-	reader, err := file.Open()
+func (r *Reader) loadCoreProperties(file ArchiveFile) (*CoreProperties, error) {
+	reader, err := r.opts.Limits.openXML(file, r.Properties.PartName)
 	if err != nil {
-		return nil, fmt.Errorf("opc: %s: cannot be opened: %v", r.Properties.PartName, err)
+		return nil, err
 	}
-	return decodeCoreProperties(reader)
+	defer reader.Close()
+	return decodeCoreProperties(reader, r.Properties.PartName)
 }
 
-func loadRelationships(file archiveFile, rels *relationshipsPart) error {
-	reader, err := file.Open()
-	if err != nil {
-		return fmt.Errorf("opc: %s: cannot be opened: %v", file.Name(), err)
-	}
-	rls, err := decodeRelationships(reader, file.Name())
+func loadRelationships(file ArchiveFile, rels *relationshipsPart, limits *ReaderLimits) error {
+	rls, err := decodeRelationshipsFile(file, limits)
 	if err != nil {
 		return err
 	}
-
-	// get part name from rels part
-	path := strings.Replace(filepath.Dir(filepath.Dir(file.Name())), `\`, "/", -1)
-	pname := "/" + path + "/" + strings.TrimSuffix(filepath.Base(file.Name()), filepath.Ext(file.Name()))
-	pname = NormalizePartName(pname)
-	rels.addRelationship(pname, rls)
+	rels.addRelationship(relationshipsSource(partNameFromZip(file.Name())), rls)
 	return nil
 }
 
-func (r *Reader) loadPackageRelationships(file archiveFile) error {
-	reader, err := file.Open()
-	if err != nil {
-		return fmt.Errorf("opc: %s: cannot be opened: %v", file.Name(), err)
+// loadRelationshipsParallel decodes the relationship parts files[i], for each i in indexes, concurrently.
+// It returns the error of the first part that fails, in the same order as indexes.
+func loadRelationshipsParallel(files []ArchiveFile, indexes []int, rels *relationshipsPart, concurrency int, limits *ReaderLimits) error {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
 	}
-	rls, err := decodeRelationships(reader, file.Name())
-	if err != nil {
-		return err
+	results := make([][]*Relationship, len(indexes))
+	errs := make([]error, len(indexes))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(indexes); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := int(atomic.AddInt64(&next, 1)); j < len(indexes); j = int(atomic.AddInt64(&next, 1)) {
+				results[j], errs[j] = decodeRelationshipsFile(files[indexes[j]], limits)
+			}
+		}()
 	}
-	r.Relationships = rls
-	for _, rel := range rls {
-		if strings.EqualFold(rel.Type, corePropsRel) {
-			r.Properties.PartName = rel.TargetURI
-			break
+	wg.Wait()
+	for j, i := range indexes {
+		if errs[j] != nil {
+			return errs[j]
 		}
+		rels.addRelationship(relationshipsSource(partNameFromZip(files[i].Name())), results[j])
 	}
 	return nil
 }
 
-type contentTypesXMLReader struct {
-	XMLName xml.Name `xml:"Types"`
-	XML     string   `xml:"xmlns,attr"`
-	Types   []mixed  `xml:",any"`
+func decodeRelationshipsFile(file ArchiveFile, limits *ReaderLimits) ([]*Relationship, error) {
+	name := partNameFromZip(file.Name())
+	reader, err := limits.openXML(file, name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	rls, err := decodeRelationships(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	if err = limits.checkRelationships(name, rls); err != nil {
+		return nil, err
+	}
+	return rls, nil
 }
 
-type mixed struct {
-	Value interface{}
+// relationshipsSource returns the name of the source part of a relationships part.
+func relationshipsSource(name string) string {
+	dir := path.Dir(path.Dir(name))
+	pname := dir + "/" + strings.TrimSuffix(path.Base(name), path.Ext(name))
+	return NormalizePartName(pname)
 }
 
-func (m *mixed) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	switch start.Name.Local {
-	case "Override":
-		var e overrideContentTypeXML
-		if err := d.DecodeElement(&e, &start); err != nil {
-			return err
-		}
-		m.Value = e
-	case "Default":
-		var e defaultContentTypeXML
-		if err := d.DecodeElement(&e, &start); err != nil {
-			return err
+func (r *Reader) loadPackageRelationships(file ArchiveFile) error {
+	reader, err := r.opts.Limits.openXML(file, packageRelName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	rls, err := decodeRelationships(reader, packageRelName)
+	if err != nil {
+		return err
+	}
+	if err = r.opts.Limits.checkRelationships(packageRelName, rls); err != nil {
+		return err
+	}
+	r.Relationships = rls
+	for _, rel := range rls {
+		if strings.EqualFold(rel.Type, corePropsRel) {
+			if r.Properties.PartName, err = rel.AbsoluteTarget("/"); err != nil {
+				return err
+			}
+			break
 		}
-		m.Value = e
 	}
 	return nil
 }
 
 func decodeContentTypes(r io.Reader) (*contentTypes, error) {
-	ctdecode := new(contentTypesXMLReader)
-	if err := xml.NewDecoder(r).Decode(ctdecode); err != nil {
-		return nil, fmt.Errorf("opc: %s: cannot be decoded: %v", contentTypesName, err)
+	ctdecode := new(xmlNode)
+	if err := newXMLDecoder(r, contentTypesName).Decode(ctdecode); err != nil {
+		return nil, decodeError(contentTypesName, err)
+	}
+	if err := validateContentTypesSchema(ctdecode); err != nil {
+		return nil, err
 	}
 	ct := new(contentTypes)
-	for _, c := range ctdecode.Types {
-		if cDefault, ok := c.Value.(defaultContentTypeXML); ok {
-			ext := strings.ToLower(cDefault.Extension)
-			if ext == "" {
-				return nil, newError(206, "/")
-			}
+	for _, c := range ctdecode.Children {
+		contentType, _ := c.attr("ContentType")
+		if c.XMLName.Local == "Default" {
+			ext, _ := c.attr("Extension")
+			ext = strings.ToLower(ext)
 			if _, ok := ct.defaults[ext]; ok {
 				return nil, newError(205, "/")
 			}
-			ct.addDefault(ext, cDefault.ContentType)
-		} else if cOverride, ok := c.Value.(overrideContentTypeXML); ok {
-			partName := strings.ToUpper(cOverride.PartName)
+			ct.addDefault(ext, contentType)
+		} else {
+			name, _ := c.attr("PartName")
+			partName := CanonicalPartName(name)
 			if _, ok := ct.overrides[partName]; ok {
 				return nil, newError(205, partName)
 			}
-			ct.addOverride(partName, cOverride.ContentType)
+			ct.addOverride(partName, contentType)
+			if ct.names == nil {
+				ct.names = make(map[string]string)
+			}
+			ct.names[partName] = name
 		}
 	}
 	return ct, nil
@@ -2,7 +2,6 @@ package opc
 
 import (
 	"encoding/xml"
-	"fmt"
 	"io"
 	"math/rand"
 	"net/url"
@@ -21,6 +20,18 @@ const (
 	ModeExternal
 )
 
+// TargetFormat is an enumerable for the different formats used to write the internal relationship targets.
+type TargetFormat int
+
+const (
+	// TargetAsIs writes the targets as they are defined in the relationships (default value).
+	TargetAsIs TargetFormat = iota
+	// TargetRelative writes the targets relative to the source part.
+	TargetRelative
+	// TargetAbsolute writes the targets as absolute part names.
+	TargetAbsolute
+)
+
 const externalMode = "External"
 const charBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ123456789"
 
@@ -31,7 +42,7 @@ const charBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ123456789
 type Relationship struct {
 	ID         string     // The relationship identifier which shall conform the xsd:ID naming restrictions and unique within the part.
 	Type       string     // Defines the role of the relationship.
-	TargetURI  string     // Holds a URI that points to a target resource. If expressed as a relative URI, it is resolved against the base URI of the Relationships source part.
+	TargetURI  string     // Holds a URI that points to a target resource, as written in the relationships part. If expressed as a relative URI, it is resolved against the base URI of the Relationships source part.
 	TargetMode TargetMode // Indicates whether or not the target describes a resource inside the package or outside the package.
 }
 
@@ -54,7 +65,9 @@ func (r *Relationship) ensureID(rnd *rand.Rand) {
 	}
 
 	b := make([]byte, 8)
-	for i := range b {
+	// The identifier shall be a xsd:ID, which cannot start with a digit
+	b[0] = charBytes[rnd.Intn(len(charBytes)-9)]
+	for i := 1; i < len(b); i++ {
 		b[i] = charBytes[rnd.Intn(len(charBytes))]
 	}
 	r.ID = string(b)
@@ -70,21 +83,43 @@ func (r *Relationship) validate(sourceURI string) error {
 	return r.validateRelationshipTarget(sourceURI)
 }
 
-func (r *Relationship) normalizeTargetURI() {
-	if r.TargetMode == ModeInternal {
-		if !strings.HasPrefix(r.TargetURI, "/") && !strings.HasPrefix(r.TargetURI, "\\") && !strings.HasPrefix(r.TargetURI, ".") {
-			r.TargetURI = "/" + r.TargetURI
-		}
+// AbsoluteTarget returns the name of the part targeted by an internal relationship,
+// resolving TargetURI against the source part name, or "/" for package relationships.
+// The TargetURI of external relationships is returned unmodified.
+func (r *Relationship) AbsoluteTarget(source string) (string, error) {
+	if r.TargetMode == ModeExternal {
+		return r.TargetURI, nil
 	}
+	return ResolveRelationshipTarget(source, r.TargetURI)
 }
 
-func (r *Relationship) toXML() *relationshipXML {
+// formatTarget returns the target URI to be written in the relationships part.
+// If the target cannot be resolved it is returned unmodified.
+func (r *Relationship) formatTarget(source string, format TargetFormat) string {
+	if r.TargetMode == ModeExternal || format == TargetAsIs {
+		return r.TargetURI
+	}
+	abs, err := r.AbsoluteTarget(source)
+	if err != nil {
+		return r.TargetURI
+	}
+	// Keep the fragment, which is not part of the part name
+	var fragment string
+	if i := strings.IndexByte(r.TargetURI, '#'); i >= 0 {
+		fragment = r.TargetURI[i:]
+	}
+	if format == TargetRelative {
+		return RelativeTarget(source, abs) + fragment
+	}
+	return abs + fragment
+}
+
+func (r *Relationship) toXML(source string, format TargetFormat) *relationshipXML {
 	var targetMode string
 	if r.TargetMode == ModeExternal {
 		targetMode = externalMode
 	}
-	r.normalizeTargetURI()
-	x := &relationshipXML{ID: r.ID, RelType: r.Type, TargetURI: r.TargetURI, Mode: targetMode}
+	x := &relationshipXML{ID: r.ID, RelType: r.Type, TargetURI: r.formatTarget(source, format), Mode: targetMode}
 	return x
 }
 
@@ -148,29 +183,35 @@ func validateRelationships(sourceURI string, rs []*Relationship) error {
 	return nil
 }
 
-func encodeRelationships(w io.Writer, rs []*Relationship) error {
+func encodeRelationships(w io.Writer, source string, rs []*Relationship, format TargetFormat) error {
 	w.Write(([]byte)(`<?xml version="1.0" encoding="UTF-8"?>`))
 	re := &relationshipsXML{XML: "http://schemas.openxmlformats.org/package/2006/relationships"}
 	for _, r := range rs {
-		re.RelsXML = append(re.RelsXML, r.toXML())
+		re.RelsXML = append(re.RelsXML, r.toXML(source, format))
 	}
 	return xml.NewEncoder(w).Encode(re)
 }
 
 func decodeRelationships(r io.Reader, partName string) ([]*Relationship, error) {
-	relDecode := new(relationshipsXML)
-	if err := xml.NewDecoder(r).Decode(relDecode); err != nil {
-		return nil, fmt.Errorf("opc: %s: cannot be decoded: %v", partName, err)
-	}
-	rel := make([]*Relationship, len(relDecode.RelsXML))
-	for i, rl := range relDecode.RelsXML {
-		newRel := &Relationship{ID: rl.ID, TargetURI: rl.TargetURI, Type: rl.RelType}
-		if rl.Mode == "" || rl.Mode == "Internal" {
+	relDecode := new(xmlNode)
+	if err := newXMLDecoder(r, partName).Decode(relDecode); err != nil {
+		return nil, decodeError(partName, err)
+	}
+	if err := validateRelationshipsSchema(relDecode, partName); err != nil {
+		return nil, err
+	}
+	rel := make([]*Relationship, len(relDecode.Children))
+	for i, rl := range relDecode.Children {
+		id, _ := rl.attr("Id")
+		relType, _ := rl.attr("Type")
+		target, _ := rl.attr("Target")
+		mode, _ := rl.attr("TargetMode")
+		newRel := &Relationship{ID: id, TargetURI: target, Type: relType}
+		if mode == "" || mode == "Internal" {
 			newRel.TargetMode = ModeInternal
 		} else {
 			newRel.TargetMode = ModeExternal
 		}
-		newRel.normalizeTargetURI()
 		rel[i] = newRel
 	}
 	return rel, nil
@@ -178,18 +219,26 @@ func decodeRelationships(r io.Reader, partName string) ([]*Relationship, error)
 
 type relationshipsPart struct {
 	relation map[string][]*Relationship // partname:relationship
+	files    map[string]ArchiveFile     // partname:relationships part not decoded yet
 }
 
 func (rp *relationshipsPart) findRelationship(name string) []*Relationship {
 	if rp.relation == nil {
 		rp.relation = make(map[string][]*Relationship)
 	}
-	return rp.relation[strings.ToUpper(name)]
+	return rp.relation[CanonicalPartName(name)]
+}
+
+func (rp *relationshipsPart) addFile(name string, f ArchiveFile) {
+	if rp.files == nil {
+		rp.files = make(map[string]ArchiveFile)
+	}
+	rp.files[CanonicalPartName(name)] = f
 }
 
 func (rp *relationshipsPart) addRelationship(name string, r []*Relationship) {
 	if rp.relation == nil {
 		rp.relation = make(map[string][]*Relationship)
 	}
-	rp.relation[strings.ToUpper(name)] = r
+	rp.relation[CanonicalPartName(name)] = r
 }
@@ -2,6 +2,7 @@ package opc
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -65,7 +66,9 @@ func TestRelationship_validate(t *testing.T) {
 
 func Test_encodeRelationships(t *testing.T) {
 	type args struct {
-		rs []*Relationship
+		source string
+		rs     []*Relationship
+		format TargetFormat
 	}
 	tests := []struct {
 		name    string
@@ -73,13 +76,17 @@ func Test_encodeRelationships(t *testing.T) {
 		wantW   string
 		wantErr bool
 	}{
-		{"base", args{[]*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "fakeTarget", TargetMode: ModeInternal}}}, expectedsolution(), false},
-		{"base2", args{[]*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "fakeTarget", TargetMode: ModeExternal}}}, expectedsolution2(), false},
+		{"base", args{"/", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "fakeTarget", TargetMode: ModeInternal}}, TargetAsIs}, expectedsolution("fakeTarget", ""), false},
+		{"base2", args{"/", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "fakeTarget", TargetMode: ModeExternal}}, TargetAbsolute}, expectedsolution("fakeTarget", "External"), false},
+		{"absolute", args{"/word/document.xml", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "../media/a.png", TargetMode: ModeInternal}}, TargetAbsolute}, expectedsolution("/media/a.png", ""), false},
+		{"relative", args{"/word/document.xml", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "/word/media/a.png", TargetMode: ModeInternal}}, TargetRelative}, expectedsolution("media/a.png", ""), false},
+		{"relativeFragment", args{"/word/document.xml", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "/media/a.xml#b", TargetMode: ModeInternal}}, TargetRelative}, expectedsolution("../media/a.xml#b", ""), false},
+		{"unresolvable", args{"/", []*Relationship{{ID: "fakeId", Type: "asd", TargetURI: "../a.png", TargetMode: ModeInternal}}, TargetAbsolute}, expectedsolution("../a.png", ""), false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			w := &bytes.Buffer{}
-			if err := encodeRelationships(w, tt.args.rs); (err != nil) != tt.wantErr {
+			if err := encodeRelationships(w, tt.args.source, tt.args.rs, tt.args.format); (err != nil) != tt.wantErr {
 				t.Errorf("encodeRelationships() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -90,10 +97,77 @@ func Test_encodeRelationships(t *testing.T) {
 	}
 }
 
-func expectedsolution() string {
-	return `<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="fakeId" Type="asd" Target="/fakeTarget"></Relationship></Relationships>`
+func TestRelationship_AbsoluteTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       *Relationship
+		source  string
+		want    string
+		wantErr bool
+	}{
+		{"package", &Relationship{TargetURI: "docProps/core.xml"}, "/", "/docProps/core.xml", false},
+		{"part", &Relationship{TargetURI: "media/image1.png"}, "/word/document.xml", "/word/media/image1.png", false},
+		{"external", &Relationship{TargetURI: "http://a.com/b", TargetMode: ModeExternal}, "/word/document.xml", "http://a.com/b", false},
+		{"aboveRoot", &Relationship{TargetURI: "../a.png"}, "/", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.r.AbsoluteTarget(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Relationship.AbsoluteTarget() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Relationship.AbsoluteTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
-func expectedsolution2() string {
-	return `<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="fakeId" Type="asd" Target="fakeTarget" TargetMode="External"></Relationship></Relationships>`
+func Test_decodeRelationships_PreserveTarget(t *testing.T) {
+	rels := new(relsBuilder).withRel("rId1", "a", "media/image1.png").withRel("rId2", "a", "../b.xml").String()
+	got, err := decodeRelationships(bytes.NewBufferString(rels), "/word/_rels/document.xml.rels")
+	if err != nil {
+		t.Fatalf("decodeRelationships() error = %v", err)
+	}
+	w := &bytes.Buffer{}
+	encodeRelationships(w, "/word/document.xml", got, TargetAsIs)
+	if got[0].TargetURI != "media/image1.png" || got[1].TargetURI != "../b.xml" {
+		t.Errorf("decodeRelationships() = %v, want targets as written", got)
+	}
+	if !strings.Contains(w.String(), `Target="media/image1.png"`) || !strings.Contains(w.String(), `Target="../b.xml"`) {
+		t.Errorf("encodeRelationships() = %v, want targets as written", w.String())
+	}
+}
+
+func expectedsolution(target, mode string) string {
+	if mode != "" {
+		mode = ` TargetMode="` + mode + `"`
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="fakeId" Type="asd" Target="` + target + `"` + mode + `></Relationship></Relationships>`
+}
+
+func Test_relationshipsPartNames(t *testing.T) {
+	tests := []struct {
+		source string
+		rels   string
+	}{
+		{"/", "/_rels/.rels"},
+		{"/a.xml", "/_rels/a.xml.rels"},
+		{"/word/document.xml", "/word/_rels/document.xml.rels"},
+		{"/a/b/c.d.xml", "/a/b/_rels/c.d.xml.rels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := relationshipsSource(tt.rels); got != tt.source {
+				t.Errorf("relationshipsSource() = %v, want %v", got, tt.source)
+			}
+			if tt.source == "/" {
+				return
+			}
+			if got := relationshipsPartName(tt.source); got != tt.rels {
+				t.Errorf("relationshipsPartName() = %v, want %v", got, tt.rels)
+			}
+		})
+	}
 }
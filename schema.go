@@ -0,0 +1,309 @@
+package opc
+
+import (
+	"encoding/xml"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const (
+	contentTypesNS   = "http://schemas.openxmlformats.org/package/2006/content-types"
+	relationshipsNS  = "http://schemas.openxmlformats.org/package/2006/relationships"
+	corePropsNS      = "http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+	dcNS             = "http://purl.org/dc/elements/1.1/"
+	dcTermsNS        = "http://purl.org/dc/terms/"
+	xsiNS            = "http://www.w3.org/2001/XMLSchema-instance"
+	xmlNS            = "http://www.w3.org/XML/1998/namespace"
+	markupCompatNS   = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+	xmlnsPrefix      = "xmlns"
+	w3cdtfSimpleType = "W3CDTF"
+)
+
+// xmlNode is a generic representation of an XML element.
+// It is used to validate the package XML parts against the OPC schemas before processing them.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+// attr returns the value of the attribute with the given local name and no namespace.
+func (n *xmlNode) attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// namespaces returns the namespace declarations of the node added to the inherited ones.
+func (n *xmlNode) namespaces(inherited map[string]string) map[string]string {
+	ns := make(map[string]string, len(inherited))
+	for k, v := range inherited {
+		ns[k] = v
+	}
+	for _, a := range n.Attrs {
+		if a.Name.Space == xmlnsPrefix {
+			ns[a.Name.Local] = a.Value
+		}
+	}
+	return ns
+}
+
+// isNamespaceDecl returns true if the attribute is a namespace declaration.
+func isNamespaceDecl(a xml.Attr) bool {
+	return a.Name.Space == xmlnsPrefix || (a.Name.Space == "" && a.Name.Local == xmlnsPrefix)
+}
+
+// checkAttrs validates that the node only has the allowed attributes, that the required ones are present
+// and that their values are syntactically valid.
+func (n *xmlNode) checkAttrs(allowed map[string]func(string) bool, required ...string) bool {
+	for _, a := range n.Attrs {
+		if isNamespaceDecl(a) {
+			continue
+		}
+		if a.Name.Space != "" {
+			return false
+		}
+		valid, ok := allowed[a.Name.Local]
+		if !ok || (valid != nil && !valid(a.Value)) {
+			return false
+		}
+	}
+	for _, r := range required {
+		if _, ok := n.attr(r); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func isAnyURI(s string) bool {
+	_, err := url.Parse(s)
+	return err == nil
+}
+
+func isContentType(s string) bool {
+	t, _, err := mime.ParseMediaType(s)
+	return err == nil && strings.Contains(t, "/") && strings.TrimSpace(s) == s
+}
+
+// isNCName reports whether s is a valid xsd:NCName, as required for the xsd:ID type.
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.' || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// isExtension reports whether s follows the ST_Extension pattern, which is a pchar sequence without dots.
+func isExtension(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-_~!$&'()*+,;=:@", c) >= 0:
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isTargetMode(s string) bool {
+	return s == "Internal" || s == externalMode
+}
+
+var (
+	relationshipAttrs = map[string]func(string) bool{"Id": nil, "Type": isAnyURI, "Target": isAnyURI, "TargetMode": isTargetMode}
+	defaultAttrs      = map[string]func(string) bool{"Extension": nil, "ContentType": isContentType}
+	overrideAttrs     = map[string]func(string) bool{"PartName": isAnyURI, "ContentType": isContentType}
+)
+
+// validateRelationshipsSchema validates a relationships part against the schema defined in ISO/IEC 29500-2 Annex E.
+func validateRelationshipsSchema(n *xmlNode, partName string) error {
+	if n.XMLName.Space != relationshipsNS || n.XMLName.Local != "Relationships" || !n.checkAttrs(nil) {
+		return newError(120, partName)
+	}
+	ids := make(map[string]struct{}, len(n.Children))
+	for i := range n.Children {
+		c := &n.Children[i]
+		id, _ := c.attr("Id")
+		if c.XMLName.Space != relationshipsNS || c.XMLName.Local != "Relationship" || len(c.Children) != 0 {
+			return newErrorRelationship(120, partName, id)
+		}
+		// ISO/IEC 29500-2 M1.26
+		if _, ok := ids[id]; ok || strings.TrimSpace(id) == "" {
+			return newErrorRelationship(126, partName, id)
+		}
+		ids[id] = struct{}{}
+		if _, ok := c.attr("Type"); !ok {
+			return newErrorRelationship(127, partName, id)
+		}
+		if _, ok := c.attr("Target"); !ok {
+			return newErrorRelationship(128, partName, id)
+		}
+		if !isNCName(id) || !c.checkAttrs(relationshipAttrs) {
+			return newErrorRelationship(120, partName, id)
+		}
+	}
+	return nil
+}
+
+// validateContentTypesSchema validates the content types part against the schema defined in ISO/IEC 29500-2 Annex E.
+func validateContentTypesSchema(n *xmlNode) error {
+	if n.XMLName.Space != contentTypesNS || n.XMLName.Local != "Types" || !n.checkAttrs(nil) {
+		return newError(120, contentTypesName)
+	}
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.XMLName.Space != contentTypesNS || len(c.Children) != 0 {
+			return newError(120, contentTypesName)
+		}
+		switch c.XMLName.Local {
+		case "Default":
+			if ext, _ := c.attr("Extension"); ext == "" {
+				return newError(206, contentTypesName)
+			} else if !isExtension(ext) || !c.checkAttrs(defaultAttrs, "ContentType") {
+				return newError(120, contentTypesName)
+			}
+		case "Override":
+			if !c.checkAttrs(overrideAttrs, "PartName", "ContentType") {
+				return newError(120, contentTypesName)
+			}
+		default:
+			return newError(120, contentTypesName)
+		}
+	}
+	return nil
+}
+
+var corePropertiesElements = map[xml.Name]bool{
+	{Space: corePropsNS, Local: "category"}:       false,
+	{Space: corePropsNS, Local: "contentStatus"}:  false,
+	{Space: dcTermsNS, Local: "created"}:          true,
+	{Space: dcNS, Local: "creator"}:               false,
+	{Space: dcNS, Local: "description"}:           false,
+	{Space: dcNS, Local: "identifier"}:            false,
+	{Space: corePropsNS, Local: "keywords"}:       false,
+	{Space: dcNS, Local: "language"}:              false,
+	{Space: corePropsNS, Local: "lastModifiedBy"}: false,
+	{Space: corePropsNS, Local: "lastPrinted"}:    false,
+	{Space: dcTermsNS, Local: "modified"}:         true,
+	{Space: corePropsNS, Local: "revision"}:       false,
+	{Space: dcNS, Local: "subject"}:               false,
+	{Space: dcNS, Local: "title"}:                 false,
+	{Space: corePropsNS, Local: "version"}:        false,
+}
+
+// validateCorePropertiesSchema validates the core properties part against the schema
+// and the requirements defined in ISO/IEC 29500-2 §11.
+// The boolean value of corePropertiesElements indicates if the element is typed as dcterms:W3CDTF.
+func validateCorePropertiesSchema(n *xmlNode, partName string) error {
+	if n.XMLName.Space != corePropsNS || n.XMLName.Local != "coreProperties" {
+		return newError(120, partName)
+	}
+	ns := n.namespaces(nil)
+	if err := validateCorePropertiesAttrs(n, partName, false, ns); err != nil {
+		return err
+	}
+	seen := make(map[xml.Name]struct{}, len(n.Children))
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.XMLName.Space == markupCompatNS {
+			// ISO/IEC 29500-2 M4.2
+			return newError(402, partName)
+		}
+		w3cdtf, ok := corePropertiesElements[c.XMLName]
+		if !ok {
+			if c.XMLName.Space == dcTermsNS {
+				// ISO/IEC 29500-2 M4.3
+				return newError(403, partName)
+			}
+			return newError(120, partName)
+		}
+		if _, ok := seen[c.XMLName]; ok {
+			return newError(120, partName)
+		}
+		seen[c.XMLName] = struct{}{}
+		if err := validateCorePropertiesAttrs(c, partName, w3cdtf, c.namespaces(ns)); err != nil {
+			return err
+		}
+		if err := validateCorePropertiesChildren(c, partName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCorePropertiesChildren(n *xmlNode, partName string) error {
+	for i := range n.Children {
+		c := &n.Children[i]
+		if c.XMLName.Space == markupCompatNS {
+			// ISO/IEC 29500-2 M4.2
+			return newError(402, partName)
+		}
+		// Only cp:keywords can have cp:value children.
+		if n.XMLName.Local != "keywords" || c.XMLName.Space != corePropsNS || c.XMLName.Local != "value" || len(c.Children) != 0 {
+			return newError(120, partName)
+		}
+	}
+	return nil
+}
+
+func validateCorePropertiesAttrs(n *xmlNode, partName string, w3cdtf bool, ns map[string]string) error {
+	var hasType bool
+	for _, a := range n.Attrs {
+		switch {
+		case isNamespaceDecl(a):
+		case a.Name.Space == markupCompatNS:
+			// ISO/IEC 29500-2 M4.2
+			return newError(402, partName)
+		case a.Name.Space == xmlNS && a.Name.Local == "lang":
+			// ISO/IEC 29500-2 M4.4
+			return newError(404, partName)
+		case a.Name.Space == xsiNS && a.Name.Local == "type":
+			// ISO/IEC 29500-2 M4.5
+			prefix, local := "", a.Value
+			if i := strings.IndexByte(a.Value, ':'); i >= 0 {
+				prefix, local = a.Value[:i], a.Value[i+1:]
+			}
+			if !w3cdtf || ns[prefix] != dcTermsNS || local != w3cdtfSimpleType {
+				return newError(405, partName)
+			}
+			hasType = true
+		default:
+			return newError(120, partName)
+		}
+	}
+	if w3cdtf && !hasType {
+		// ISO/IEC 29500-2 M4.5
+		return newError(405, partName)
+	}
+	return nil
+}
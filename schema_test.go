@@ -0,0 +1,129 @@
+package opc
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_decodeRelationships_Schema(t *testing.T) {
+	rels := func(s string) string {
+		return `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + s + `</Relationships>`
+	}
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+	}{
+		{"base", rels(`<Relationship Id="rId1" Type="a" Target="b.xml"/><Relationship Id="rId2" Type="a" Target="http://a.com" TargetMode="External"/>`), 0},
+		{"otherNamespace", `<Relationships xmlns="http://other.com"><Relationship Id="rId1" Type="a" Target="b.xml"/></Relationships>`, 120},
+		{"noNamespace", `<Relationships><Relationship Id="rId1" Type="a" Target="b.xml"/></Relationships>`, 120},
+		{"rootAttr", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships" a="b"></Relationships>`, 120},
+		{"unknownChild", rels(`<Relation Id="rId1" Type="a" Target="b.xml"/>`), 120},
+		{"nestedChild", rels(`<Relationship Id="rId1" Type="a" Target="b.xml"><Relationship Id="rId2" Type="a" Target="b.xml"/></Relationship>`), 120},
+		{"unknownAttr", rels(`<Relationship Id="rId1" Type="a" Target="b.xml" Other="c"/>`), 120},
+		{"foreignAttr", rels(`<Relationship xmlns:o="http://other.com" Id="rId1" Type="a" Target="b.xml" o:Other="c"/>`), 120},
+		{"invalidTargetMode", rels(`<Relationship Id="rId1" Type="a" Target="b.xml" TargetMode="external"/>`), 120},
+		{"invalidID", rels(`<Relationship Id="1rId" Type="a" Target="b.xml"/>`), 120},
+		{"invalidTarget", rels(`<Relationship Id="rId1" Type="a" Target="://b.xml"/>`), 120},
+		{"missingID", rels(`<Relationship Type="a" Target="b.xml"/>`), 126},
+		{"duplicatedID", rels(`<Relationship Id="rId1" Type="a" Target="b.xml"/><Relationship Id="rId1" Type="a" Target="c.xml"/>`), 126},
+		{"missingType", rels(`<Relationship Id="rId1" Target="b.xml"/>`), 127},
+		{"missingTarget", rels(`<Relationship Id="rId1" Type="a"/>`), 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeRelationships(bytes.NewBufferString(tt.content), "/_rels/.rels")
+			checkErrorCode(t, "decodeRelationships()", err, tt.wantCode)
+		})
+	}
+}
+
+func Test_decodeContentTypes_Schema(t *testing.T) {
+	types := func(s string) string {
+		return `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` + s + `</Types>`
+	}
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+	}{
+		{"base", types(`<Default Extension="xml" ContentType="application/xml"/><Override PartName="/a.bin" ContentType="a/b"/>`), 0},
+		{"otherNamespace", `<Types xmlns="http://other.com"><Default Extension="xml" ContentType="application/xml"/></Types>`, 120},
+		{"unknownChild", types(`<Fake Extension="xml" ContentType="application/xml"/>`), 120},
+		{"nestedChild", types(`<Default Extension="xml" ContentType="application/xml"><Default Extension="a" ContentType="a/b"/></Default>`), 120},
+		{"unknownAttr", types(`<Default Extension="xml" ContentType="application/xml" PartName="/a.xml"/>`), 120},
+		{"missingContentType", types(`<Override PartName="/a.xml"/>`), 120},
+		{"missingPartName", types(`<Override ContentType="a/b"/>`), 120},
+		{"invalidContentType", types(`<Default Extension="xml" ContentType="application"/>`), 120},
+		{"invalidExtension", types(`<Default Extension="a.xml" ContentType="a/b"/>`), 120},
+		{"emptyExtension", types(`<Default Extension="" ContentType="a/b"/>`), 206},
+		{"duplicatedExtension", types(`<Default Extension="xml" ContentType="a/b"/><Default Extension="XML" ContentType="a/c"/>`), 205},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeContentTypes(bytes.NewBufferString(tt.content))
+			checkErrorCode(t, "decodeContentTypes()", err, tt.wantCode)
+		})
+	}
+}
+
+func Test_decodeCoreProperties_Schema(t *testing.T) {
+	core := func(s string) string {
+		return `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` + s + `</cp:coreProperties>`
+	}
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+	}{
+		{"base", core(`<dc:title>a</dc:title><cp:keywords>b<cp:value>c</cp:value></cp:keywords><dcterms:created xsi:type="dcterms:W3CDTF">2019</dcterms:created>`), 0},
+		{"otherPrefix", `<coreProperties xmlns="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:t="http://purl.org/dc/terms/" xmlns:i="http://www.w3.org/2001/XMLSchema-instance"><t:modified i:type="t:W3CDTF">2019</t:modified></coreProperties>`, 0},
+		{"otherNamespace", `<coreProperties xmlns="http://other.com"></coreProperties>`, 120},
+		{"unknownElement", core(`<cp:other>a</cp:other>`), 120},
+		{"duplicatedElement", core(`<dc:title>a</dc:title><dc:title>b</dc:title>`), 120},
+		{"nestedElement", core(`<dc:title><dc:title>b</dc:title></dc:title>`), 120},
+		{"unknownAttr", core(`<dc:title a="b">a</dc:title>`), 120},
+		{"markupCompatibility", core(`<mc:AlternateContent xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006"/>`), 402},
+		{"markupCompatibilityAttr", core(`<dc:title xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" mc:Ignorable="a">a</dc:title>`), 402},
+		{"refinement", core(`<dcterms:available>2019</dcterms:available>`), 403},
+		{"lang", core(`<dc:title xml:lang="en">a</dc:title>`), 404},
+		{"typeNotAllowed", core(`<dc:title xsi:type="dcterms:W3CDTF">a</dc:title>`), 405},
+		{"typeMissing", core(`<dcterms:created>2019</dcterms:created>`), 405},
+		{"typeInvalid", core(`<dcterms:created xsi:type="dcterms:Period">2019</dcterms:created>`), 405},
+		{"typeInvalidPrefix", core(`<dcterms:created xsi:type="dc:W3CDTF">2019</dcterms:created>`), 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCoreProperties(bytes.NewBufferString(tt.content), "/docProps/core.xml")
+			checkErrorCode(t, "decodeCoreProperties()", err, tt.wantCode)
+		})
+	}
+}
+
+func TestCoreProperties_encodeDecode(t *testing.T) {
+	want := &CoreProperties{"", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o"}
+	w := &bytes.Buffer{}
+	if err := want.encode(w); err != nil {
+		t.Fatalf("CoreProperties.encode() error = %v", err)
+	}
+	got, err := decodeCoreProperties(w, "/props/core.xml")
+	if err != nil {
+		t.Fatalf("decodeCoreProperties() error = %v", err)
+	}
+	if *got != *want {
+		t.Errorf("decodeCoreProperties() = %v, want %v", got, want)
+	}
+}
+
+func checkErrorCode(t *testing.T, fn string, err error, want int) {
+	t.Helper()
+	if want == 0 {
+		if err != nil {
+			t.Errorf("%s error = %v, want nil", fn, err)
+		}
+		return
+	}
+	if e, ok := err.(*Error); !ok || e.Code() != want {
+		t.Errorf("%s error = %v, want code %d", fn, err, want)
+	}
+}
@@ -0,0 +1,295 @@
+package opc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DefaultSeekSpan is the distance between checkpoints used by BuildSeekIndex when none is provided.
+const DefaultSeekSpan = 1 << 20
+
+const seekIndexMagic = "OPCSEEK1"
+
+// deflatedFile is implemented by the archive files that can provide their raw DEFLATE stream.
+type deflatedFile interface {
+	openDeflated() (*io.SectionReader, uint32, error)
+}
+
+// SeekCheckpoint is a position of a DEFLATE stream from which the decompression can be restarted.
+type SeekCheckpoint struct {
+	In     int64  // Offset in bits of the beginning of a DEFLATE block in the compressed data.
+	Out    int64  // Offset in bytes of the uncompressed data.
+	Window []byte // Uncompressed data preceding Out, up to 32KB.
+}
+
+// SeekIndex contains the checkpoints of a deflated part, which allow reading from any offset
+// by only decompressing the data after the nearest preceding checkpoint.
+// A SeekIndex can be serialized using MarshalBinary and loaded using UnmarshalBinary.
+type SeekIndex struct {
+	Size        int64            // Size of the uncompressed data.
+	CRC32       uint32           // CRC-32 of the uncompressed data.
+	Checkpoints []SeekCheckpoint // Checkpoints sorted by offset, the first one is always at the beginning of the data.
+}
+
+// BuildSeekIndex decompresses the part once and returns a SeekIndex
+// with a checkpoint at the first DEFLATE block after each span uncompressed bytes.
+// If span is less or equal than zero DefaultSeekSpan is used.
+// The decompression fails as soon as the data is bigger than the part Size,
+// which has already been checked against the ReaderLimits, so DEFLATE bombs are not fully decompressed.
+// The index is also set to the File, as in SetSeekIndex.
+// It is safe to call BuildSeekIndex and SetSeekIndex concurrently with OpenSeeker.
+func (f *File) BuildSeekIndex(span int64) (*SeekIndex, error) {
+	df, ok := f.a.(deflatedFile)
+	if !ok {
+		return nil, fmt.Errorf("opc: %s: seek index not supported", f.Name)
+	}
+	sr, crc, err := df.openDeflated()
+	if err != nil {
+		return nil, err
+	}
+	if span <= 0 {
+		span = DefaultSeekSpan
+	}
+	idx := &SeekIndex{CRC32: crc}
+	inf := newInflater(sr)
+	inf.max = int64(f.Size)
+	err = inf.inflate(func() error {
+		if len(idx.Checkpoints) == 0 || inf.out-idx.Checkpoints[len(idx.Checkpoints)-1].Out >= span {
+			idx.Checkpoints = append(idx.Checkpoints, SeekCheckpoint{In: inf.bitPos(), Out: inf.out, Window: inf.window()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opc: %s: cannot be indexed: %v", f.Name, err)
+	}
+	if inf.out != int64(f.Size) {
+		return nil, fmt.Errorf("opc: %s: cannot be indexed: %v", f.Name, io.ErrUnexpectedEOF)
+	}
+	if inf.checksum() != crc {
+		return nil, fmt.Errorf("opc: %s: cannot be indexed: checksum error", f.Name)
+	}
+	idx.Size = inf.out
+	f.index.Store(idx)
+	return idx, nil
+}
+
+// SetSeekIndex sets a SeekIndex previously built for this File, so OpenSeeker supports deflated parts.
+// It returns an error if the index does not match the File content.
+func (f *File) SetSeekIndex(idx *SeekIndex) error {
+	df, ok := f.a.(deflatedFile)
+	if !ok {
+		return fmt.Errorf("opc: %s: seek index not supported", f.Name)
+	}
+	_, crc, err := df.openDeflated()
+	if err != nil {
+		return err
+	}
+	if idx.CRC32 != crc || idx.Size != int64(f.Size) || !idx.valid() {
+		return fmt.Errorf("opc: %s: seek index does not match the part", f.Name)
+	}
+	f.index.Store(idx)
+	return nil
+}
+
+// MarshalBinary encodes the index into a binary form.
+func (x *SeekIndex) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(seekIndexMagic)
+	binary.Write(&buf, binary.LittleEndian, x.Size)
+	binary.Write(&buf, binary.LittleEndian, x.CRC32)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(x.Checkpoints)))
+	for _, c := range x.Checkpoints {
+		binary.Write(&buf, binary.LittleEndian, c.In)
+		binary.Write(&buf, binary.LittleEndian, c.Out)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(c.Window)))
+		buf.Write(c.Window)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the index from a binary form produced by MarshalBinary.
+// It checks that the checkpoints are consistent, but not that they match the part, see SetSeekIndex.
+func (x *SeekIndex) UnmarshalBinary(data []byte) error {
+	errInvalid := errors.New("opc: invalid seek index")
+	if !bytes.HasPrefix(data, []byte(seekIndexMagic)) {
+		return errInvalid
+	}
+	r := bytes.NewReader(data[len(seekIndexMagic):])
+	var n uint32
+	if binary.Read(r, binary.LittleEndian, &x.Size) != nil ||
+		binary.Read(r, binary.LittleEndian, &x.CRC32) != nil ||
+		binary.Read(r, binary.LittleEndian, &n) != nil || x.Size < 0 {
+		return errInvalid
+	}
+	x.Checkpoints = make([]SeekCheckpoint, 0, n)
+	for i := uint32(0); i < n; i++ {
+		var c SeekCheckpoint
+		var l uint32
+		if binary.Read(r, binary.LittleEndian, &c.In) != nil ||
+			binary.Read(r, binary.LittleEndian, &c.Out) != nil ||
+			binary.Read(r, binary.LittleEndian, &l) != nil || l > maxWindow {
+			return errInvalid
+		}
+		var prev *SeekCheckpoint
+		if i > 0 {
+			prev = &x.Checkpoints[i-1]
+		}
+		if !validCheckpoint(x.Size, prev, c, int64(l)) {
+			return errInvalid
+		}
+		if l > 0 {
+			c.Window = make([]byte, l)
+			if _, err := io.ReadFull(r, c.Window); err != nil {
+				return errInvalid
+			}
+		}
+		x.Checkpoints = append(x.Checkpoints, c)
+	}
+	if r.Len() != 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// validCheckpoint returns true if c, with a window of l bytes, can follow prev in an index of the given size.
+// The first checkpoint, without prev, is at the beginning of the data and the next ones go strictly forward
+// in both the compressed and the uncompressed data, with a window of the preceding 32KB.
+func validCheckpoint(size int64, prev *SeekCheckpoint, c SeekCheckpoint, l int64) bool {
+	want := c.Out
+	if want > maxWindow {
+		want = maxWindow
+	}
+	if c.In < 0 || c.Out < 0 || c.Out > size || l != want {
+		return false
+	}
+	if prev == nil {
+		return c.In == 0 && c.Out == 0
+	}
+	return c.In > prev.In && c.Out > prev.Out
+}
+
+// valid returns true if the checkpoints are consistent.
+func (x *SeekIndex) valid() bool {
+	if x.Size < 0 || len(x.Checkpoints) == 0 {
+		return false
+	}
+	var prev *SeekCheckpoint
+	for i, c := range x.Checkpoints {
+		if !validCheckpoint(x.Size, prev, c, int64(len(c.Window))) {
+			return false
+		}
+		prev = &x.Checkpoints[i]
+	}
+	return true
+}
+
+// indexedReader reads a deflated part using the checkpoints of a SeekIndex.
+type indexedReader struct {
+	name   string
+	sr     *io.SectionReader
+	idx    *SeekIndex
+	pos    int64
+	buf    []byte // uncompressed data between two checkpoints, starting at bufPos
+	bufPos int64
+}
+
+func newIndexedReader(name string, sr *io.SectionReader, idx *SeekIndex) *indexedReader {
+	return &indexedReader{name: name, sr: sr, idx: idx}
+}
+
+// checkpoint returns the index of the nearest checkpoint preceding off.
+func (r *indexedReader) checkpoint(off int64) int {
+	cps := r.idx.Checkpoints
+	i := sort.Search(len(cps), func(i int) bool { return cps[i].Out > off }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// decode fills p with the uncompressed data starting at off.
+// It returns io.EOF if the data ends before p is full.
+func (r *indexedReader) decode(p []byte, off int64) (int, error) {
+	c := r.idx.Checkpoints[r.checkpoint(off)]
+	if c.In < 0 || c.In/8 > r.sr.Size() || c.Out > off {
+		return 0, fmt.Errorf("opc: %s: cannot be read: invalid seek index", r.name)
+	}
+	inf, err := newInflaterAt(io.NewSectionReader(r.sr, c.In/8, r.sr.Size()-c.In/8), c.In, c.Out, c.Window)
+	if err != nil {
+		return 0, fmt.Errorf("opc: %s: cannot be read: %v", r.name, err)
+	}
+	inf.dst, inf.from, inf.max = p, off, r.idx.Size
+	err = inf.inflate(func() error { return nil })
+	var n int
+	if inf.out > off {
+		n = int(inf.out - off)
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	switch err {
+	case errInflateDone:
+		return n, nil
+	case nil:
+		return n, io.EOF
+	}
+	return n, fmt.Errorf("opc: %s: cannot be read: %v", r.name, err)
+}
+
+func (r *indexedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("opc: negative offset")
+	}
+	if off >= r.idx.Size {
+		return 0, io.EOF
+	}
+	return r.decode(p, off)
+}
+
+func (r *indexedReader) Read(p []byte) (int, error) {
+	if r.pos >= r.idx.Size {
+		return 0, io.EOF
+	}
+	if r.pos < r.bufPos || r.pos >= r.bufPos+int64(len(r.buf)) {
+		// Decode the data until the next checkpoint, so sequential reads do not restart the decompression.
+		i := r.checkpoint(r.pos)
+		end := r.idx.Size
+		if i+1 < len(r.idx.Checkpoints) {
+			end = r.idx.Checkpoints[i+1].Out
+		}
+		start := r.idx.Checkpoints[i].Out
+		buf := make([]byte, end-start)
+		n, err := r.decode(buf, start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if int64(n) < end-start {
+			return 0, fmt.Errorf("opc: %s: cannot be read: %v", r.name, io.ErrUnexpectedEOF)
+		}
+		r.buf, r.bufPos = buf, start
+	}
+	n := copy(p, r.buf[r.pos-r.bufPos:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *indexedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.idx.Size
+	default:
+		return 0, errors.New("opc: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("opc: negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,208 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func seekTestReader(t testing.TB, content []byte, compression CompressionOption) *Reader {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	pw, _ := w.CreatePart(&Part{Name: "/mesh.xml", ContentType: "application/xml"}, compression)
+	pw.Write(content)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	return r
+}
+
+func TestFile_BuildSeekIndex(t *testing.T) {
+	content := testContent(1 << 20)
+	for _, compression := range []CompressionOption{CompressionNormal, CompressionMaximum, CompressionSuperFast} {
+		r := seekTestReader(t, content, compression)
+		f := r.Files[0]
+		idx, err := f.BuildSeekIndex(64 << 10)
+		if err != nil {
+			t.Fatalf("File.BuildSeekIndex() error = %v", err)
+		}
+		if idx.Size != int64(len(content)) || len(idx.Checkpoints) < 2 {
+			t.Fatalf("File.BuildSeekIndex() size = %d, checkpoints = %d", idx.Size, len(idx.Checkpoints))
+		}
+		rs, err := f.OpenSeeker()
+		if err != nil {
+			t.Fatalf("File.OpenSeeker() error = %v", err)
+		}
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 50; i++ {
+			off := rnd.Int63n(int64(len(content)))
+			b := make([]byte, rnd.Intn(100<<10))
+			n, err := rs.ReadAt(b, off)
+			if err != nil && err != io.EOF {
+				t.Fatalf("ReadAt(%d) error = %v", off, err)
+			}
+			if !bytes.Equal(b[:n], content[off:off+int64(n)]) || (n < len(b) && off+int64(n) != int64(len(content))) {
+				t.Fatalf("ReadAt(%d) returned wrong content", off)
+			}
+		}
+		rs.Seek(int64(len(content))/2, io.SeekStart)
+		rs.Seek(-10, io.SeekCurrent)
+		rest, err := ioutil.ReadAll(rs)
+		if err != nil || !bytes.Equal(rest, content[len(content)/2-10:]) {
+			t.Errorf("Read() after Seek returned wrong content, error = %v", err)
+		}
+		if _, err := rs.ReadAt(make([]byte, 1), int64(len(content))); err != io.EOF {
+			t.Errorf("ReadAt() past the end error = %v, want EOF", err)
+		}
+	}
+}
+
+func TestSeekIndex_MarshalBinary(t *testing.T) {
+	content := testContent(300 << 10)
+	r := seekTestReader(t, content, CompressionNormal)
+	idx, err := r.Files[0].BuildSeekIndex(32 << 10)
+	if err != nil {
+		t.Fatalf("File.BuildSeekIndex() error = %v", err)
+	}
+	data, _ := idx.MarshalBinary()
+	got := new(SeekIndex)
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("SeekIndex.UnmarshalBinary() error = %v", err)
+	}
+	if len(got.Checkpoints) != len(idx.Checkpoints) || got.Size != idx.Size || got.CRC32 != idx.CRC32 {
+		t.Fatalf("SeekIndex.UnmarshalBinary() = %+v, want %+v", got, idx)
+	}
+	r = seekTestReader(t, content, CompressionNormal)
+	if err := r.Files[0].SetSeekIndex(got); err != nil {
+		t.Fatalf("File.SetSeekIndex() error = %v", err)
+	}
+	rs, _ := r.Files[0].OpenSeeker()
+	b := make([]byte, 1000)
+	if _, err := rs.ReadAt(b, 200<<10); err != nil || !bytes.Equal(b, content[200<<10:200<<10+1000]) {
+		t.Errorf("ReadAt() with a loaded index returned wrong content, error = %v", err)
+	}
+	if err := got.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("SeekIndex.UnmarshalBinary() want error for truncated data")
+	}
+	if err := got.UnmarshalBinary([]byte("invalid")); err == nil {
+		t.Error("SeekIndex.UnmarshalBinary() want error for invalid data")
+	}
+}
+
+func TestFile_SetSeekIndex(t *testing.T) {
+	r := seekTestReader(t, testContent(1000), CompressionNormal)
+	if err := r.Files[0].SetSeekIndex(&SeekIndex{Size: 1000, Checkpoints: []SeekCheckpoint{{}}}); err == nil {
+		t.Error("File.SetSeekIndex() want error for a mismatched index")
+	}
+	r = seekTestReader(t, testContent(1000), CompressionNone)
+	if _, err := r.Files[0].BuildSeekIndex(0); err == nil {
+		t.Error("File.BuildSeekIndex() want error for stored parts")
+	}
+	f := &File{Part: &Part{Name: "/c.bin"}, a: newMockFile("c.bin", nil, nil)}
+	if _, err := f.BuildSeekIndex(0); err == nil {
+		t.Error("File.BuildSeekIndex() want error for non seekable archives")
+	}
+}
+
+func TestFile_BuildSeekIndex_bomb(t *testing.T) {
+	var data bytes.Buffer
+	fw, _ := flate.NewWriter(&data, flate.BestCompression)
+	fw.Write(make([]byte, 10<<20))
+	fw.Close()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	cw, _ := zw.Create("[Content_Types].xml")
+	cw.Write([]byte(new(cTypeBuilder).withDefault("a/b", "bin").String()))
+	// The item declares a much smaller size than the content
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "a.bin", Method: zip.Deflate, CompressedSize64: uint64(data.Len()), UncompressedSize64: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data.Bytes())
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := r.Files[0].BuildSeekIndex(0); err == nil || !strings.Contains(err.Error(), errInflateSize.Error()) {
+		t.Errorf("File.BuildSeekIndex() error = %v, want %v", err, errInflateSize)
+	}
+}
+
+func TestSeekIndex_UnmarshalBinary_checkpoints(t *testing.T) {
+	window := func(n int) []byte { return make([]byte, n) }
+	tests := []struct {
+		name string
+		idx  SeekIndex
+	}{
+		{"firstNotAtStart", SeekIndex{Size: 100, Checkpoints: []SeekCheckpoint{{In: 8, Out: 10, Window: window(10)}}}},
+		{"outOfSize", SeekIndex{Size: 100, Checkpoints: []SeekCheckpoint{{}, {In: 8, Out: 200, Window: window(200)}}}},
+		{"backwards", SeekIndex{Size: 100, Checkpoints: []SeekCheckpoint{{}, {In: 16, Out: 50, Window: window(50)}, {In: 8, Out: 40, Window: window(40)}}}},
+		{"window", SeekIndex{Size: 100, Checkpoints: []SeekCheckpoint{{}, {In: 8, Out: 50, Window: window(10)}}}},
+		{"negativeSize", SeekIndex{Size: -1, Checkpoints: []SeekCheckpoint{{}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := tt.idx.MarshalBinary()
+			if err := new(SeekIndex).UnmarshalBinary(data); err == nil {
+				t.Error("SeekIndex.UnmarshalBinary() want error")
+			}
+			if tt.idx.valid() {
+				t.Error("SeekIndex.valid() = true, want false")
+			}
+		})
+	}
+}
+
+func TestFile_BuildSeekIndex_concurrent(t *testing.T) {
+	content := testContent(300 << 10)
+	f := seekTestReader(t, content, CompressionNormal).Files[0]
+	done := make(chan error)
+	go func() {
+		_, err := f.BuildSeekIndex(32 << 10)
+		done <- err
+	}()
+	for built := false; !built; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("File.BuildSeekIndex() error = %v", err)
+			}
+			built = true
+		default:
+		}
+		if rs, err := f.OpenSeeker(); err == nil {
+			b := make([]byte, 100)
+			if _, err := rs.ReadAt(b, 200<<10); err != nil || !bytes.Equal(b, content[200<<10:200<<10+100]) {
+				t.Fatalf("ReadAt() returned wrong content, error = %v", err)
+			}
+		}
+	}
+	if _, err := f.OpenSeeker(); err != nil {
+		t.Errorf("File.OpenSeeker() error = %v", err)
+	}
+}
+
+func BenchmarkFile_BuildSeekIndex(b *testing.B) {
+	content := testContent(8 << 20)
+	r := seekTestReader(b, content, CompressionNormal)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Files[0].BuildSeekIndex(0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
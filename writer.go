@@ -3,10 +3,12 @@ package opc
 import (
 	"archive/zip"
 	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
-	"path/filepath"
+	"path"
+	"sync"
 	"time"
 )
 
@@ -14,7 +16,7 @@ import (
 type CompressionOption int
 
 const (
-	// CompressionNone disables the compression.
+	// CompressionNone disables the compression, the part is stored as is.
 	CompressionNone CompressionOption = iota - 1
 	// CompressionNormal is optimized for a reasonable compromise between size and performance.
 	CompressionNormal
@@ -28,12 +30,22 @@ const (
 
 // Writer implements a OPC file writer.
 type Writer struct {
-	Properties    CoreProperties  // Package metadata. Can be modified until the Writer is closed.
-	Relationships []*Relationship // The relationships associated to the package. Can be modified until the Writer is closed.
-	p             *pkg
-	w             *zip.Writer
-	last          *Part
-	rnd           *rand.Rand
+	Properties        CoreProperties    // Package metadata. Can be modified until the Writer is closed.
+	Relationships     []*Relationship   // The relationships associated to the package. Can be modified until the Writer is closed.
+	TargetFormat      TargetFormat      // The format of the internal relationship targets. Can be modified until the Writer is closed.
+	CompressionPolicy CompressionPolicy // The compression used by Create, DefaultCompressionPolicy if nil. Can be modified until the Writer is closed.
+	p                 *pkg
+	w                 *zip.Writer
+	a                 ArchiveWriter // used instead of w if not nil
+	last              *Part
+	rnd               *rand.Rand
+	par               *parallelWriter
+	compressors       map[CompressionOption]compressor
+	file              *atomicFile // set by Create
+	app               *appender   // set when appending to an existing package
+	closed            bool        // closed or aborted
+	aborted           bool
+	closeErr          error // result of the first Close
 }
 
 // NewWriter returns a new Writer writing an OPC file to w.
@@ -41,45 +53,168 @@ func NewWriter(w io.Writer) *Writer {
 	return &Writer{p: newPackage(), w: zip.NewWriter(w), rnd: rand.New(rand.NewSource(42))}
 }
 
+// NewWriterToArchive returns a new Writer writing an OPC package to the archive a.
+// It applies the same validations as NewWriter, only the physical mapping is done by a.
+// The compression options and parallel compression are not supported, as they are specific to ZIP.
+func NewWriterToArchive(a ArchiveWriter) *Writer {
+	return &Writer{p: newPackage(), a: a, rnd: rand.New(rand.NewSource(42))}
+}
+
+// SetCompressor sets or overrides a custom compressor for the DEFLATE
+// used by the parts created with the given compression option.
+// The general purpose flags of the compression option are kept.
+// Setting a compressor for CompressionNone makes those parts to be deflated with comp instead of stored.
+// If comp is nil the default compressor is restored.
+// When using parallel compression comp is called from multiple goroutines.
+func (w *Writer) SetCompressor(compression CompressionOption, comp func(w io.Writer) (io.WriteCloser, error)) {
+	if comp == nil {
+		delete(w.compressors, compression)
+		return
+	}
+	if w.compressors == nil {
+		w.compressors = make(map[CompressionOption]compressor)
+	}
+	w.compressors[compression] = comp
+}
+
 // Flush flushes any buffered data to the underlying writer.
 // Part metadata, relationships, content types and other OPC related files won't be flushed.
 // Calling Flush is not normally necessary; calling Close is sufficient.
 // Useful to do simultaneous writing and reading.
+// When using parallel compression only the parts that have already been compressed are flushed.
 func (w *Writer) Flush() error {
+	if w.par != nil {
+		if err := w.par.writeDone(); err != nil {
+			return err
+		}
+	}
+	if w.a != nil {
+		if f, ok := w.a.(interface{ Flush() error }); ok {
+			return f.Flush()
+		}
+		return nil
+	}
 	return w.w.Flush()
 }
 
 // Close finishes writing the opc file.
 // It does not close the underlying writer.
+// If the Writer was returned by Create the file is only replaced if Close succeeds.
+// If the Writer is appending to an existing package the package is restored if Close fails.
+// Calling Close again returns the result of the first call, and calling it after Abort fails.
 func (w *Writer) Close() error {
+	if w.aborted {
+		return errors.New("opc: writer aborted")
+	}
+	if !w.closed {
+		w.closed = true
+		w.closeErr = w.close()
+	}
+	return w.closeErr
+}
+
+func (w *Writer) close() error {
+	err := w.finish()
+	if w.app != nil {
+		if aerr := w.app.end(err != nil); err == nil {
+			err = aerr
+		}
+		return err
+	}
+	if w.file == nil {
+		return err
+	}
+	if err != nil {
+		w.file.remove()
+		return err
+	}
+	return w.file.commit()
+}
+
+// Abort discards the package being written and the Writer cannot be used after that.
+// If the Writer was returned by Create the temporary file is removed, leaving the target file untouched.
+// If the Writer is appending to an existing package the package is restored to its original content.
+// If the ArchiveWriter implements Abort() error it is called.
+// Otherwise the data already written to the underlying writer is kept and it is up to the caller to discard it,
+// which is the case of NewDirWriter, whose files already written are left in the folder.
+// Calling Abort after Close has no effect, so it can be deferred to clean up on failure.
+func (w *Writer) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed, w.aborted = true, true
+	if w.par != nil {
+		w.par.abort()
+	}
+	if w.file != nil {
+		return w.file.remove()
+	}
+	if w.app != nil {
+		return w.app.end(true)
+	}
+	if a, ok := w.a.(interface{ Abort() error }); ok {
+		return a.Abort()
+	}
+	return nil
+}
+
+func (w *Writer) finish() error {
 	if err := w.createLastPartRelationships(); err != nil {
-		w.w.Close()
+		w.closeArchive()
+		return err
+	}
+	if err := w.createExistingRelationships(); err != nil {
+		w.closeArchive()
 		return err
 	}
 	if err := w.createCoreProperties(); err != nil {
-		w.w.Close()
+		w.closeArchive()
 		return err
 	}
 	if err := w.createOwnRelationships(); err != nil {
-		w.w.Close()
+		w.closeArchive()
 		return err
 	}
 	if err := w.createContentTypes(); err != nil {
-		w.w.Close()
+		w.closeArchive()
 		return err
 	}
+	if w.par != nil {
+		if err := w.par.close(); err != nil {
+			w.closeArchive()
+			return err
+		}
+	}
+	return w.closeArchive()
+}
+
+func (w *Writer) closeArchive() error {
+	if w.app != nil {
+		return w.app.merge(w.w)
+	}
+	if w.a != nil {
+		return w.a.Close()
+	}
 	return w.w.Close()
 }
 
 // Create adds a file to the OPC archive using the provided name and content type.
-// The file contents will be compressed using the Deflate default method.
+// The file contents will be compressed using the option returned by the CompressionPolicy.
 // The name shall be a valid part name, one can use NormalizePartName before calling Create to normalize it
 //
 // This returns a Writer to which the file contents should be written.
 // The file's contents must be written to the io.Writer before the next call to Create, CreatePart, or Close.
 func (w *Writer) Create(name, contentType string) (io.Writer, error) {
 	part := &Part{Name: name, ContentType: contentType}
-	return w.add(part, CompressionNormal)
+	return w.add(part, w.compression(name, contentType))
+}
+
+// compression returns the compression option of a part as defined by the CompressionPolicy.
+func (w *Writer) compression(name, contentType string) CompressionOption {
+	if w.CompressionPolicy == nil {
+		return DefaultCompressionPolicy(name, contentType)
+	}
+	return w.CompressionPolicy(name, contentType)
 }
 
 // CreatePart adds a file to the OPC archive using the provided part.
@@ -95,7 +230,7 @@ func (w *Writer) CreatePart(part *Part, compression CompressionOption) (io.Write
 }
 
 func (w *Writer) createCoreProperties() error {
-	if w.Properties == (CoreProperties{}) {
+	if w.Properties == (CoreProperties{}) || (w.app != nil && w.Properties == w.app.props) {
 		return nil
 	}
 	partName := w.Properties.PartName
@@ -107,10 +242,25 @@ func (w *Writer) createCoreProperties() error {
 	if err != nil {
 		return err
 	}
-	w.Relationships = append(w.Relationships, &Relationship{"", corePropsRel, part.Name, ModeInternal})
+	if !w.hasRelationship(corePropsRel, part.Name) {
+		w.Relationships = append(w.Relationships, &Relationship{"", corePropsRel, part.Name, ModeInternal})
+	}
 	return w.Properties.encode(cw)
 }
 
+// hasRelationship returns true if the package has a relationship of type relType targeting partName.
+func (w *Writer) hasRelationship(relType, partName string) bool {
+	for _, r := range w.Relationships {
+		if r.Type != relType || r.TargetMode != ModeInternal {
+			continue
+		}
+		if target, err := ResolveRelationshipTarget("/", r.TargetURI); err == nil && PartNamesEquivalent(target, partName) {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *Writer) createContentTypes() error {
 	// ISO/IEC 29500-2 M3.10
 	cw, err := w.addToPackage(&Part{Name: contentTypesName, ContentType: "text/xml"}, CompressionNormal)
@@ -121,6 +271,12 @@ func (w *Writer) createContentTypes() error {
 }
 
 func (w *Writer) createOwnRelationships() error {
+	if w.app != nil {
+		if !relationshipsChanged(w.Relationships, w.app.rels) {
+			return nil
+		}
+		w.app.remove(packageRelName)
+	}
 	if len(w.Relationships) == 0 {
 		return nil
 	}
@@ -134,32 +290,46 @@ func (w *Writer) createOwnRelationships() error {
 	if err != nil {
 		return err
 	}
-	return encodeRelationships(rw, w.Relationships)
+	return encodeRelationships(rw, "/", w.Relationships, w.TargetFormat)
 }
 
 func (w *Writer) createLastPartRelationships() error {
-	if w.last == nil || len(w.last.Relationships) == 0 {
+	if w.last == nil {
 		return nil
 	}
-	for _, r := range w.last.Relationships {
+	return w.createPartRelationships(w.last.Name, w.last.Relationships)
+}
+
+func (w *Writer) createPartRelationships(partName string, rels []*Relationship) error {
+	if len(rels) == 0 {
+		return nil
+	}
+	for _, r := range rels {
 		r.ensureID(w.rnd)
 	}
-	if err := validateRelationships(w.last.Name, w.last.Relationships); err != nil {
+	if err := validateRelationships(partName, rels); err != nil {
 		return err
 	}
-	dirName := filepath.Dir(w.last.Name)[1:]
-	if dirName != "" {
-		dirName = "/" + dirName
-	}
-	relName := fmt.Sprintf("%s/_rels/%s.rels", dirName, filepath.Base(w.last.Name))
-	rw, err := w.addToPackage(&Part{Name: relName, ContentType: relationshipContentType}, CompressionNormal)
+	rw, err := w.addToPackage(&Part{Name: relationshipsPartName(partName), ContentType: relationshipContentType}, CompressionNormal)
 	if err != nil {
 		return err
 	}
-	return encodeRelationships(rw, w.last.Relationships)
+	return encodeRelationships(rw, partName, rels, w.TargetFormat)
+}
+
+// relationshipsPartName returns the name of the relationships part of the source part partName.
+func relationshipsPartName(partName string) string {
+	dirName := path.Dir(partName)[1:]
+	if dirName != "" {
+		dirName = "/" + dirName
+	}
+	return fmt.Sprintf("%s/_rels/%s.rels", dirName, path.Base(partName))
 }
 
 func (w *Writer) add(part *Part, compression CompressionOption) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("opc: writer already closed")
+	}
 	if err := w.createLastPartRelationships(); err != nil {
 		return nil, err
 	}
@@ -179,8 +349,16 @@ func (w *Writer) addToPackage(part *Part, compression CompressionOption) (io.Wri
 		Name:     zipName(part.Name),
 		Modified: time.Now(),
 	}
-	w.setCompressor(fh, compression)
-	pw, err := w.w.CreateHeader(fh)
+	if !isASCII(fh.Name) {
+		// Language encoding flag, the item name is encoded using UTF-8
+		fh.Flags |= 0x800
+	}
+	comp := w.setCompressor(fh, compression)
+	if err := validateZipHeader(fh, part.Name); err != nil {
+		w.p.deletePart(part.Name)
+		return nil, err
+	}
+	pw, err := w.createEntry(fh, part.Name, comp)
 	if err != nil {
 		w.p.deletePart(part.Name)
 		return nil, fmt.Errorf("opc: %s: cannot be created: %v", part.Name, err)
@@ -188,7 +366,23 @@ func (w *Writer) addToPackage(part *Part, compression CompressionOption) (io.Wri
 	return pw, nil
 }
 
-func (w *Writer) setCompressor(fh *zip.FileHeader, compression CompressionOption) {
+func (w *Writer) createEntry(fh *zip.FileHeader, name string, comp compressor) (io.Writer, error) {
+	if w.app != nil {
+		w.app.create(fh.Name)
+	}
+	if w.a != nil {
+		return w.a.Create(fh.Name)
+	}
+	if w.par != nil {
+		return w.par.create(fh, name, comp)
+	}
+	if comp != nil {
+		w.w.RegisterCompressor(zip.Deflate, zip.Compressor(comp))
+	}
+	return w.w.CreateHeader(fh)
+}
+
+func (w *Writer) setCompressor(fh *zip.FileHeader, compression CompressionOption) compressor {
 	var comp int
 	switch compression {
 	case CompressionNormal:
@@ -203,22 +397,80 @@ func (w *Writer) setCompressor(fh *zip.FileHeader, compression CompressionOption
 		comp = flate.BestSpeed
 		fh.Flags |= 0x6
 	case CompressionNone:
-		comp = flate.NoCompression
+		if custom, ok := w.compressors[compression]; ok {
+			fh.Method = zip.Deflate
+			return custom
+		}
+		fh.Method = zip.Store
+		return nil
 	default:
 		comp = -1000 // write will failt
 	}
 
 	fh.Method = zip.Deflate
-	w.w.RegisterCompressor(zip.Deflate, compressionFunc(comp))
+	if custom, ok := w.compressors[compression]; ok {
+		return custom
+	}
+	if comp >= flate.HuffmanOnly && comp <= flate.BestCompression {
+		return flateCompressors[comp-flate.HuffmanOnly]
+	}
+	return compressionFunc(comp)
 }
 
-func compressionFunc(comp int) func(out io.Writer) (io.WriteCloser, error) {
+// flateCompressors contains a compressor for each valid flate level, indexed by level-flate.HuffmanOnly.
+// They are shared by all the writers so registering them does not allocate.
+var flateCompressors [flate.BestCompression - flate.HuffmanOnly + 1]compressor
+
+// flateWriterPools contains a pool of flate writers for each valid flate level, indexed by level-flate.HuffmanOnly.
+var flateWriterPools [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+
+func init() {
+	for i := range flateCompressors {
+		flateCompressors[i] = compressionFunc(i + flate.HuffmanOnly)
+	}
+}
+
+// compressionFunc returns a compressor that reuses the flate writers of the given level.
+// The flate writer is reset when the compressor is requested and returned to the pool when it is closed.
+func compressionFunc(comp int) compressor {
+	if comp < flate.HuffmanOnly || comp > flate.BestCompression {
+		return func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, comp)
+		}
+	}
+	pool := &flateWriterPools[comp-flate.HuffmanOnly]
 	return func(out io.Writer) (io.WriteCloser, error) {
-		return flate.NewWriter(out, comp)
+		if fw, ok := pool.Get().(*flate.Writer); ok {
+			fw.Reset(out)
+			return &pooledFlateWriter{fw: fw, pool: pool}, nil
+		}
+		fw, err := flate.NewWriter(out, comp)
+		if err != nil {
+			return nil, err
+		}
+		return &pooledFlateWriter{fw: fw, pool: pool}, nil
+	}
+}
+
+// pooledFlateWriter is a flate writer that is returned to its pool when closed.
+type pooledFlateWriter struct {
+	fw   *flate.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledFlateWriter) Write(p []byte) (int, error) {
+	if w.fw == nil {
+		return 0, errors.New("opc: write to closed compressor")
 	}
+	return w.fw.Write(p)
 }
 
-func zipName(partName string) string {
-	// ISO/IEC 29500-2 M3.4
-	return partName[1:] // remove first slash
+func (w *pooledFlateWriter) Close() error {
+	if w.fw == nil {
+		return errors.New("opc: compressor already closed")
+	}
+	err := w.fw.Close()
+	w.pool.Put(w.fw)
+	w.fw = nil
+	return err
 }
@@ -0,0 +1,56 @@
+package opc
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Create creates the OPC file specified by name and returns a Writer writing to it.
+// The package is written to a temporary file in the same folder, which only replaces
+// the named file once the Writer is successfully closed.
+// If Close fails or Abort is called the temporary file is removed and the named file is left untouched.
+func Create(name string) (*Writer, error) {
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	w := NewWriter(f)
+	w.file = &atomicFile{f: f, name: name}
+	return w, nil
+}
+
+// atomicFile is a temporary file which is renamed to name when committed.
+type atomicFile struct {
+	f    *os.File
+	name string
+}
+
+// commit makes the temporary file durable and renames it to the target name.
+func (a *atomicFile) commit() error {
+	err := a.f.Sync()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(a.f.Name(), a.name)
+	}
+	if err != nil {
+		os.Remove(a.f.Name())
+	}
+	return err
+}
+
+// remove deletes the temporary file.
+func (a *atomicFile) remove() error {
+	a.f.Close()
+	return os.Remove(a.f.Name())
+}
@@ -0,0 +1,125 @@
+package opc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.docx")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer w.Abort()
+	pw, _ := w.Create("/a.xml", "application/xml")
+	pw.Write([]byte("<a/>"))
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Create() file exists before Close")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if err = w.Abort(); err != nil {
+		t.Errorf("Writer.Abort() after Close error = %v", err)
+	}
+	r, err := OpenReader(name)
+	if err != nil {
+		t.Fatalf("OpenReader() error = %v", err)
+	}
+	r.Close()
+	if names := dirNames(t, dir); len(names) != 1 {
+		t.Errorf("Create() files = %v, want only a.docx", names)
+	}
+	if err = w.Close(); err != nil {
+		t.Errorf("Writer.Close() second call error = %v", err)
+	}
+}
+
+func TestCreate_failure(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel bool
+		finish   func(w *Writer) error
+	}{
+		{"abort", false, func(w *Writer) error {
+			if err := w.Abort(); err != nil {
+				t.Fatalf("Writer.Abort() error = %v", err)
+			}
+			if _, err := w.Create("/b.xml", "application/xml"); err == nil {
+				t.Error("Writer.Create() want error after Abort")
+			}
+			return w.Close()
+		}},
+		{"closeError", false, func(w *Writer) error {
+			w.Relationships = []*Relationship{{ID: "rId1", Type: "a", TargetURI: "b.xml", TargetMode: ModeInternal}, {ID: "rId1", Type: "a", TargetURI: "c.xml"}}
+			err := w.Close()
+			if err2 := w.Close(); err2 != err {
+				t.Errorf("Writer.Close() second call error = %v, want %v", err2, err)
+			}
+			return err
+		}},
+		{"parallelAbort", true, func(w *Writer) error {
+			w.Abort()
+			return w.Close()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, "a.docx")
+			if err := ioutil.WriteFile(name, []byte("previous"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			w, err := Create(name)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if tt.parallel {
+				w.SetParallelCompression(2, 0)
+			}
+			pw, _ := w.Create("/a.xml", "application/xml")
+			pw.Write([]byte("<a/>"))
+			if err = tt.finish(w); err == nil {
+				t.Error("Writer.Close() want error")
+			}
+			if b, _ := ioutil.ReadFile(name); string(b) != "previous" {
+				t.Errorf("target file = %s, want previous", b)
+			}
+			if names := dirNames(t, dir); len(names) != 1 {
+				t.Errorf("files = %v, want only a.docx", names)
+			}
+		})
+	}
+}
+
+func TestCreate_permissions(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.docx")
+	ioutil.WriteFile(name, nil, 0600)
+	w, err := Create(name)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Create() mode = %v, %v, want the previous mode", fi, err)
+	}
+}
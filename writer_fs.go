@@ -0,0 +1,189 @@
+package opc
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ContentTypeRegistry maps file extensions, in lower case and without the leading dot, to content types.
+type ContentTypeRegistry map[string]string
+
+// DefaultContentTypes is the registry used by AddFS when none is provided.
+// It can be copied and extended to register other extensions.
+var DefaultContentTypes = ContentTypeRegistry{
+	"xml":   "application/xml",
+	"rels":  relationshipContentType,
+	"txt":   "text/plain",
+	"htm":   "text/html",
+	"html":  "text/html",
+	"css":   "text/css",
+	"csv":   "text/csv",
+	"js":    "application/javascript",
+	"json":  "application/json",
+	"pdf":   "application/pdf",
+	"bin":   "application/octet-stream",
+	"zip":   "application/zip",
+	"png":   "image/png",
+	"jpg":   "image/jpeg",
+	"jpeg":  "image/jpeg",
+	"gif":   "image/gif",
+	"bmp":   "image/bmp",
+	"tif":   "image/tiff",
+	"tiff":  "image/tiff",
+	"webp":  "image/webp",
+	"svg":   "image/svg+xml",
+	"emf":   "image/x-emf",
+	"wmf":   "image/x-wmf",
+	"mp3":   "audio/mpeg",
+	"wav":   "audio/wav",
+	"mp4":   "video/mp4",
+	"ttf":   "font/ttf",
+	"otf":   "font/otf",
+	"woff":  "font/woff",
+	"woff2": "font/woff2",
+	"model": "application/vnd.ms-package.3dmanufacturing-3dmodel+xml",
+	"vml":   "application/vnd.openxmlformats-officedocument.vmlDrawing",
+}
+
+// ContentType returns the content type registered for the extension of name.
+func (r ContentTypeRegistry) ContentType(name string) (string, bool) {
+	ext := path.Ext(name)
+	if ext == "" {
+		return "", false
+	}
+	t, ok := r[strings.ToLower(ext[1:])]
+	return t, ok
+}
+
+// AddFSOptions configures how AddFS packs the files.
+type AddFSOptions struct {
+	ContentTypes       ContentTypeRegistry // Registry used to infer the content types, DefaultContentTypes if nil.
+	DefaultContentType string              // Content type of the files not found in the registry. If empty they make AddFS fail.
+}
+
+// AddFS adds to the package all the files of the root folder of fsys, walked in lexical order.
+// A folder of the file system can be added using os.DirFS.
+// The file paths relative to root are normalized with NormalizePartName.
+// A [Content_Types].xml file in root takes precedence over the content types registry,
+// and the relationship parts, such as _rels/.rels or word/_rels/document.xml.rels,
+// are decoded and set to their source part or to the Writer Relationships instead of being added as parts.
+// Relationship parts whose source part does not exist are ignored.
+// The parts are compressed using the option returned by the CompressionPolicy.
+func (w *Writer) AddFS(fsys fs.FS, root string, opts AddFSOptions) error {
+	registry := opts.ContentTypes
+	if registry == nil {
+		registry = DefaultContentTypes
+	}
+	var names []string
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var (
+		ct    *contentTypes
+		rels  = make(map[string]fsPart) // relationship parts by canonical source part name
+		parts []fsPart
+	)
+	for _, name := range names {
+		p := fsPart{file: name, name: fsPartName(root, name)}
+		switch {
+		case PartNamesEquivalent(p.name, contentTypesName):
+			if ct, err = decodeContentTypesFS(fsys, name); err != nil {
+				return err
+			}
+		case isRelationshipURI(p.name):
+			rels[CanonicalPartName(relationshipsSource(p.name))] = p
+		default:
+			parts = append(parts, p)
+		}
+	}
+	if p, ok := rels[CanonicalPartName("/")]; ok {
+		rls, err := decodeRelationshipsFS(fsys, p)
+		if err != nil {
+			return err
+		}
+		w.Relationships = append(w.Relationships, rls...)
+	}
+	for _, p := range parts {
+		contentType, ok := "", false
+		if ct != nil {
+			contentType, err = ct.findType(p.name)
+			ok = err == nil
+		}
+		if !ok {
+			if contentType, ok = registry.ContentType(p.name); !ok {
+				if opts.DefaultContentType == "" {
+					return fmt.Errorf("opc: %s: unknown content type", p.name)
+				}
+				contentType = opts.DefaultContentType
+			}
+		}
+		part := &Part{Name: p.name, ContentType: contentType}
+		if rp, ok := rels[CanonicalPartName(p.name)]; ok {
+			if part.Relationships, err = decodeRelationshipsFS(fsys, rp); err != nil {
+				return err
+			}
+		}
+		if err = w.addFSFile(fsys, p.file, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsPart is a file of a fs.FS and its part name.
+type fsPart struct {
+	file string
+	name string
+}
+
+// fsPartName returns the part name of a file found when walking root.
+func fsPartName(root, name string) string {
+	if root != "." {
+		name = strings.TrimPrefix(name, root+"/")
+	}
+	return NormalizePartName(name)
+}
+
+func (w *Writer) addFSFile(fsys fs.FS, name string, part *Part) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pw, err := w.CreatePart(part, w.compression(part.Name, part.ContentType))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(pw, f)
+	return err
+}
+
+func decodeContentTypesFS(fsys fs.FS, name string) (*contentTypes, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeContentTypes(f)
+}
+
+func decodeRelationshipsFS(fsys fs.FS, p fsPart) ([]*Relationship, error) {
+	f, err := fsys.Open(p.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeRelationships(f, p.name)
+}
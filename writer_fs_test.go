@@ -0,0 +1,97 @@
+package opc
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriter_AddFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pkg/a.xml":            {Data: []byte("<a/>")},
+		"pkg/img/b.PNG":        {Data: []byte("png")},
+		"pkg/img/été.jpg":      {Data: []byte("jpg")},
+		"pkg/data/c.unknown":   {Data: []byte("c")},
+		"pkg/_rels/a.xml.rels": {Data: []byte(new(relsBuilder).withRel("rId1", "t", "img/b.PNG").String())},
+		"other/d.xml":          {Data: []byte("<d/>")},
+	}
+	tests := []struct {
+		name    string
+		opts    AddFSOptions
+		want    map[string]string
+		wantErr bool
+	}{
+		{"unknown", AddFSOptions{}, nil, true},
+		{"default", AddFSOptions{DefaultContentType: "application/octet-stream"}, map[string]string{
+			"/a.xml": "application/xml", "/img/b.PNG": "image/png", "/img/%C3%A9t%C3%A9.jpg": "image/jpeg", "/data/c.unknown": "application/octet-stream",
+		}, false},
+		{"registry", AddFSOptions{ContentTypes: ContentTypeRegistry{"xml": "text/xml", "unknown": "a/b"}, DefaultContentType: "c/d"}, map[string]string{
+			"/a.xml": "text/xml", "/img/b.PNG": "c/d", "/img/%C3%A9t%C3%A9.jpg": "c/d", "/data/c.unknown": "a/b",
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			w := NewWriter(buf)
+			err := w.AddFS(fsys, "pkg", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Writer.AddFS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("Writer.Close() error = %v", err)
+			}
+			r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			got := make(map[string]string)
+			for _, f := range r.Files {
+				got[f.Name] = f.ContentType
+				if f.Name == "/a.xml" && (len(f.Relationships) != 1 || f.Relationships[0].TargetURI != "img/b.PNG") {
+					t.Errorf("Writer.AddFS() relationships = %v", f.Relationships)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Writer.AddFS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriter_AddFS_package(t *testing.T) {
+	// Pack an unzipped package, which has its own content types and relationships
+	dir := t.TempDir()
+	writeSamplePackage(t, NewDirWriter(dir))
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err := w.AddFS(os.DirFS(dir), ".", AddFSOptions{}); err != nil {
+		t.Fatalf("Writer.AddFS() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	want, err := OpenDirReader(dir)
+	if err != nil {
+		t.Fatalf("OpenDirReader() error = %v", err)
+	}
+	if !reflect.DeepEqual(r.Relationships, want.Relationships) || r.Properties != want.Properties {
+		t.Errorf("Writer.AddFS() package = %v %v, want %v %v", r.Relationships, r.Properties, want.Relationships, want.Properties)
+	}
+	if len(r.Files) != len(want.Files) {
+		t.Fatalf("Writer.AddFS() files = %v, want %v", r.Files, want.Files)
+	}
+	for i, f := range want.Files {
+		if !reflect.DeepEqual(r.Files[i].Part, f.Part) {
+			t.Errorf("Writer.AddFS() part = %v, want %v", r.Files[i].Part, f.Part)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultParallelMemoryLimit is the memory limit used by SetParallelCompression when none is provided.
+const DefaultParallelMemoryLimit = 256 << 20
+
+const zipExtraExtTime = 0x5455
+
+type compressor func(io.Writer) (io.WriteCloser, error)
+
+// SetParallelCompression enables the compression of up to workers parts at the same time.
+// The content of each part is buffered in memory and compressed by a pool of workers goroutines
+// once the next part is created or the Writer is closed. The goroutines are stopped by Close or Abort.
+// The compressed parts are written in the same order they were created,
+// so the output does not depend on the scheduling of the workers.
+//
+// memoryLimit is the approximate amount of bytes that can be buffered at the same time,
+// counting both the uncompressed content and the compressed output of the parts not written yet;
+// if it is reached the Writer blocks until the pending parts are written.
+// A single part bigger than memoryLimit is still buffered completely.
+// If memoryLimit is less or equal than zero DefaultParallelMemoryLimit is used.
+// If workers is less or equal than one the compression is done sequentially, which is the default behavior.
+//
+// SetParallelCompression must be called before creating any part.
+func (w *Writer) SetParallelCompression(workers int, memoryLimit int64) error {
+	if w.last != nil || len(w.p.parts) > 0 {
+		return errors.New("opc: parallel compression must be set before creating any part")
+	}
+	if w.a != nil && workers > 1 {
+		return errors.New("opc: parallel compression is only supported by ZIP archives")
+	}
+	if workers <= 1 {
+		w.par = nil
+		return nil
+	}
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultParallelMemoryLimit
+	}
+	w.par = &parallelWriter{zw: w.w, workers: workers, limit: memoryLimit}
+	return nil
+}
+
+// parallelWriter compresses parts concurrently and writes them in order to the zip archive.
+// It is not safe for concurrent use, only the compression is done in other goroutines.
+type parallelWriter struct {
+	mem     int64 // bytes buffered by the pending and the current part, accessed atomically
+	zw      *zip.Writer
+	workers int
+	jobs    chan *pendingPart // consumed by the workers, nil until the first part is compressed
+	limit   int64
+	pending []*pendingPart // parts being compressed, in creation order
+	current *pendingPart   // part being written by the caller
+}
+
+type pendingPart struct {
+	fh   *zip.FileHeader
+	name string
+	comp compressor
+	raw  bytes.Buffer
+	out  bytes.Buffer
+	done chan struct{}
+	err  error
+}
+
+func (pw *parallelWriter) create(fh *zip.FileHeader, name string, comp compressor) (io.Writer, error) {
+	pw.closeCurrent()
+	if err := pw.writePending(pw.limit); err != nil {
+		return nil, err
+	}
+	pw.current = &pendingPart{fh: fh, name: name, comp: comp, done: make(chan struct{})}
+	return &parallelPartWriter{pw: pw, p: pw.current}, nil
+}
+
+// closeCurrent starts the compression of the part being written.
+func (pw *parallelWriter) closeCurrent() {
+	if pw.current == nil {
+		return
+	}
+	p := pw.current
+	pw.current = nil
+	pw.pending = append(pw.pending, p)
+	if pw.jobs == nil {
+		pw.jobs = make(chan *pendingPart, pw.workers)
+		for i := 0; i < pw.workers; i++ {
+			go pw.work(pw.jobs)
+		}
+	}
+	pw.jobs <- p
+}
+
+func (pw *parallelWriter) work(jobs <-chan *pendingPart) {
+	for p := range jobs {
+		p.compress(&pw.mem)
+	}
+}
+
+// stop finishes the workers once they have compressed the queued parts.
+func (pw *parallelWriter) stop() {
+	if pw.jobs != nil {
+		close(pw.jobs)
+		pw.jobs = nil
+	}
+}
+
+func (pw *parallelWriter) memory() int64 {
+	return atomic.LoadInt64(&pw.mem)
+}
+
+// writePending writes the pending parts to the zip archive, in order,
+// until the buffered memory is less than limit.
+func (pw *parallelWriter) writePending(limit int64) error {
+	for len(pw.pending) > 0 && pw.memory() >= limit {
+		if err := pw.writeOne(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDone writes the pending parts which have already been compressed, in order, without blocking.
+func (pw *parallelWriter) writeDone() error {
+	for len(pw.pending) > 0 {
+		select {
+		case <-pw.pending[0].done:
+		default:
+			return nil
+		}
+		if err := pw.writeOne(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOne waits until the first pending part is compressed and writes it.
+func (pw *parallelWriter) writeOne() error {
+	p := pw.pending[0]
+	<-p.done
+	pw.pending[0] = nil
+	pw.pending = pw.pending[1:]
+	out := int64(p.out.Len())
+	err := p.writeTo(pw.zw)
+	atomic.AddInt64(&pw.mem, -out)
+	return err
+}
+
+// abort discards the parts not written yet, the compressions in progress finish on their own.
+func (pw *parallelWriter) abort() {
+	pw.current, pw.pending = nil, nil
+	pw.stop()
+}
+
+// close compresses and writes all the remaining parts.
+func (pw *parallelWriter) close() error {
+	defer pw.stop()
+	pw.closeCurrent()
+	for len(pw.pending) > 0 {
+		if err := pw.writeOne(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress compresses the part, mem is updated as the compressed output grows and the uncompressed content is released.
+func (p *pendingPart) compress(mem *int64) {
+	defer close(p.done)
+	b := p.raw.Bytes()
+	p.fh.CRC32 = crc32.ChecksumIEEE(b)
+	p.fh.UncompressedSize64 = uint64(len(b))
+	if p.comp == nil {
+		// Stored part
+		p.out, p.raw = p.raw, bytes.Buffer{}
+		p.fh.CompressedSize64 = p.fh.UncompressedSize64
+		return
+	}
+	defer func() {
+		p.raw = bytes.Buffer{}
+		atomic.AddInt64(mem, -int64(len(b)))
+	}()
+	fw, err := p.comp(&countingWriter{w: &p.out, n: mem})
+	if err != nil {
+		p.err = err
+		return
+	}
+	_, err = fw.Write(b)
+	if cerr := fw.Close(); err == nil {
+		err = cerr
+	}
+	p.err = err
+	p.fh.CompressedSize64 = uint64(p.out.Len())
+}
+
+// countingWriter adds the number of bytes written to n atomically.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+func (p *pendingPart) writeTo(zw *zip.Writer) error {
+	if p.err != nil {
+		return fmt.Errorf("opc: %s: cannot be created: %v", p.name, p.err)
+	}
+	prepareRawHeader(p.fh)
+	w, err := zw.CreateRaw(p.fh)
+	if err == nil {
+		_, err = w.Write(p.out.Bytes())
+	}
+	if err != nil {
+		return fmt.Errorf("opc: %s: cannot be created: %v", p.name, err)
+	}
+	p.out = bytes.Buffer{}
+	return nil
+}
+
+// prepareRawHeader fills the header fields that zip.Writer.CreateHeader sets
+// but zip.Writer.CreateRaw expects to be already set.
+func prepareRawHeader(fh *zip.FileHeader) {
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | 20
+	fh.ReaderVersion = 20
+	if fh.Modified.IsZero() {
+		return
+	}
+	fh.ModifiedDate, fh.ModifiedTime = msDosTime(fh.Modified)
+	// Extended timestamp extra field, the same as zip.Writer.CreateHeader adds.
+	var extra [9]byte
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraExtTime)
+	binary.LittleEndian.PutUint16(extra[2:], 5)
+	extra[4] = 1 // modification time is present
+	binary.LittleEndian.PutUint32(extra[5:], uint32(fh.Modified.Unix()))
+	fh.Extra = append(fh.Extra, extra[:]...)
+}
+
+func msDosTime(t time.Time) (uint16, uint16) {
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
+
+// parallelPartWriter buffers the content of a part until its compression starts.
+type parallelPartWriter struct {
+	pw *parallelWriter
+	p  *pendingPart
+}
+
+func (w *parallelPartWriter) Write(b []byte) (int, error) {
+	if w.pw.current != w.p {
+		return 0, fmt.Errorf("opc: %s: write to closed part", w.p.name)
+	}
+	n, _ := w.p.raw.Write(b)
+	if atomic.AddInt64(&w.pw.mem, int64(n)) > w.pw.limit {
+		// Free memory by writing the parts that are already being compressed
+		if err := w.pw.writePending(w.pw.limit); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
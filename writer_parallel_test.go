@@ -0,0 +1,199 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestPackage(t testing.TB, workers int, memoryLimit int64, n int) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if err := w.SetParallelCompression(workers, memoryLimit); err != nil {
+		t.Fatal(err)
+	}
+	w.Properties.Title = "Song"
+	w.Relationships = []*Relationship{{ID: "rId1", Type: "a", TargetURI: "/a/0.xml"}}
+	for i := 0; i < n; i++ {
+		part := &Part{Name: fmt.Sprintf("/a/%d.xml", i), ContentType: "application/xml"}
+		if i%2 == 0 {
+			part.Relationships = []*Relationship{{ID: "rId1", Type: "b", TargetURI: "/a/1.xml"}}
+		}
+		pw, err := w.CreatePart(part, CompressionOption(i%4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pw.Write([]byte(strings.Repeat(fmt.Sprintf("<a>%d</a>", i), i*10)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zipEntries(t *testing.T, b []byte) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	entries := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("zip item %s cannot be opened: %v", f.Name, err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("zip item %s cannot be read: %v", f.Name, err)
+		}
+		// The data descriptor flag depends on whether the sizes are known when writing the header
+		entries[i] = fmt.Sprintf("%s %d %x %s", f.Name, f.Flags&^0x8, f.CRC32, content)
+	}
+	return entries
+}
+
+func TestWriter_SetParallelCompression(t *testing.T) {
+	want := zipEntries(t, writeTestPackage(t, 1, 0, 20))
+	tests := []struct {
+		name        string
+		workers     int
+		memoryLimit int64
+	}{
+		{"default", 4, 0},
+		{"lowMemory", 4, 1},
+		{"manyWorkers", 64, 1 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := writeTestPackage(t, tt.workers, tt.memoryLimit, 20)
+			got := zipEntries(t, b)
+			if len(got) != len(want) {
+				t.Fatalf("Writer.SetParallelCompression() entries = %d, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("Writer.SetParallelCompression() entry %d = %.50s, want %.50s", i, got[i], want[i])
+				}
+			}
+			if _, err := NewReader(bytes.NewReader(b), int64(len(b))); err != nil {
+				t.Errorf("NewReader() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWriter_SetParallelCompression_afterCreate(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	w.Create("/a.xml", "a/b")
+	if err := w.SetParallelCompression(4, 0); err == nil {
+		t.Error("Writer.SetParallelCompression() want error after creating a part")
+	}
+}
+
+func TestWriter_parallelErrors(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	w.SetParallelCompression(2, 0)
+	pw, err := w.CreatePart(&Part{Name: "/a.xml", ContentType: "a/b"}, -3)
+	if err != nil {
+		t.Fatalf("Writer.CreatePart() error = %v", err)
+	}
+	pw.Write([]byte("a"))
+	if _, err := w.Create("/b.xml", "a/b"); err != nil {
+		t.Fatalf("Writer.Create() error = %v", err)
+	}
+	if _, err := pw.Write([]byte("a")); err == nil {
+		t.Error("Write() want error after creating the next part")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Writer.Close() want error with an invalid compression")
+	}
+}
+
+func TestWriter_parallelFlush(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetParallelCompression(2, 0)
+	pw, _ := w.Create("/a.xml", "a/b")
+	pw.Write([]byte("content"))
+	w.Create("/b.xml", "a/b")
+	<-w.par.pending[0].done
+	if err := w.Flush(); err != nil {
+		t.Errorf("Writer.Flush() error = %v", err)
+	}
+	if len(w.par.pending) != 0 {
+		t.Errorf("Writer.Flush() pending parts = %d, want 0", len(w.par.pending))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if got := zipEntries(t, buf.Bytes()); len(got) != 3 {
+		t.Errorf("Writer.Flush() entries = %d, want 3", len(got))
+	}
+}
+
+func TestWriter_parallelWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	w := NewWriter(new(bytes.Buffer))
+	w.SetParallelCompression(3, 1<<10)
+	content := []byte(strings.Repeat("<a>content</a>", 200))
+	for i := 0; i < 50; i++ {
+		pw, err := w.Create(fmt.Sprintf("/a/%d.xml", i), "a/b")
+		if err != nil {
+			t.Fatalf("Writer.Create() error = %v", err)
+		}
+		pw.Write(content)
+		if n := runtime.NumGoroutine() - before; n > 3 {
+			t.Fatalf("goroutines = %d, want at most 3", n)
+		}
+		// The limit counts the uncompressed and the compressed buffers of the pending parts,
+		// the compressions in progress can exceed it by the size of a part
+		if mem, max := w.par.memory(), int64(1<<10+2*len(content)); mem > max {
+			t.Fatalf("buffered memory = %d, want at most %d", mem, max)
+		}
+	}
+	par := w.par
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if mem := par.memory(); mem != 0 {
+		t.Errorf("buffered memory after Close = %d, want 0", mem)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine() - before; n > 0 {
+		t.Errorf("goroutines after Close = %d, want 0", n)
+	}
+}
+
+func BenchmarkWriter_Parallel(b *testing.B) {
+	content := bytes.Repeat([]byte(`<a xmlns="http://a.b"><b>some repeated content</b></a>`), 1<<12)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(content)) * 100)
+			for i := 0; i < b.N; i++ {
+				w := NewWriter(ioutil.Discard)
+				w.SetParallelCompression(workers, 0)
+				for j := 0; j < 100; j++ {
+					pw, err := w.Create(fmt.Sprintf("/a/%d.xml", j), "application/xml")
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(pw, bytes.NewReader(content))
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
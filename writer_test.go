@@ -3,6 +3,10 @@ package opc
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"testing"
 )
@@ -82,14 +86,94 @@ func TestWriter_setCompressor(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.w.setCompressor(tt.args.fh, tt.args.compression)
+			comp := tt.w.setCompressor(tt.args.fh, tt.args.compression)
+			if tt.args.compression == CompressionNone {
+				if tt.args.fh.Method != zip.Store || comp != nil {
+					t.Error("Writer.setCompressor() should have set the method flag to store")
+				}
+				return
+			}
 			if tt.args.fh.Method != zip.Deflate {
 				t.Error("Writer.setCompressor() should have set the method flag the deflate")
 			}
+			if tt.args.fh.Flags != tt.wantFlag {
+				t.Errorf("Writer.setCompressor() flags = %x, want %x", tt.args.fh.Flags, tt.wantFlag)
+			}
 		})
 	}
 }
 
+func TestWriter_Create_compressionPolicy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	for _, name := range []string{"/a.xml", "/b.png", "/c.bin"} {
+		pw, err := w.Create(name, "application/octet-stream")
+		if err != nil {
+			t.Fatalf("Writer.Create() error = %v", err)
+		}
+		pw.Write([]byte("content content content"))
+	}
+	w.CompressionPolicy = func(name, contentType string) CompressionOption {
+		return CompressionNone
+	}
+	w.Create("/d.xml", "application/xml")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	want := map[string]uint16{"a.xml": zip.Deflate, "b.png": zip.Store, "c.bin": zip.Deflate, "d.xml": zip.Store}
+	for _, f := range zr.File {
+		if m, ok := want[f.Name]; ok && f.Method != m {
+			t.Errorf("Writer.Create() %s method = %d, want %d", f.Name, f.Method, m)
+		}
+	}
+}
+
+func TestWriter_SetCompressor(t *testing.T) {
+	var calls int
+	custom := func(out io.Writer) (io.WriteCloser, error) {
+		calls++
+		return flate.NewWriter(out, flate.BestCompression)
+	}
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.SetCompressor(CompressionMaximum, custom)
+	w.SetCompressor(CompressionNone, custom)
+	w.SetCompressor(CompressionFast, custom)
+	w.SetCompressor(CompressionFast, nil)
+	for i, compression := range []CompressionOption{CompressionMaximum, CompressionNone, CompressionFast, CompressionNormal} {
+		pw, err := w.CreatePart(&Part{Name: fmt.Sprintf("/%d.xml", i), ContentType: "a/b"}, compression)
+		if err != nil {
+			t.Fatalf("Writer.CreatePart() error = %v", err)
+		}
+		pw.Write([]byte("content"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Writer.SetCompressor() custom compressor calls = %d, want 2", calls)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	want := map[string]uint16{"0.xml": 0x2, "1.xml": 0x0, "2.xml": 0x4, "3.xml": 0x0}
+	for _, f := range zr.File {
+		if flags, ok := want[f.Name]; ok {
+			if got := f.Flags &^ 0x8; got != flags {
+				t.Errorf("Writer.SetCompressor() %s flags = %x, want %x", f.Name, got, flags)
+			}
+			if f.Method != zip.Deflate {
+				t.Errorf("Writer.SetCompressor() %s method = %d, want deflate", f.Name, f.Method)
+			}
+		}
+	}
+}
+
 func Test_compressionFunc(t *testing.T) {
 	type args struct {
 		comp int
@@ -99,6 +183,8 @@ func Test_compressionFunc(t *testing.T) {
 		args args
 	}{
 		{"base", args{1}},
+		{"huffman", args{flate.HuffmanOnly}},
+		{"invalid", args{-1000}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,6 +193,31 @@ func Test_compressionFunc(t *testing.T) {
 	}
 }
 
+func Test_compressionFunc_reuse(t *testing.T) {
+	comp := compressionFunc(flate.BestSpeed)
+	for _, content := range []string{"first part content", "second"} {
+		buf := new(bytes.Buffer)
+		fw, err := comp(buf)
+		if err != nil {
+			t.Fatalf("compressionFunc() error = %v", err)
+		}
+		fw.Write([]byte(content))
+		if err := fw.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if err := fw.Close(); err == nil {
+			t.Error("Close() want error on second call")
+		}
+		if _, err := fw.Write([]byte("a")); err == nil {
+			t.Error("Write() want error after Close")
+		}
+		got, _ := ioutil.ReadAll(flate.NewReader(buf))
+		if string(got) != content {
+			t.Errorf("compressionFunc() decompressed = %s, want %s", got, content)
+		}
+	}
+}
+
 func TestWriter_Create(t *testing.T) {
 	type args struct {
 		uri         string
@@ -197,3 +308,59 @@ func TestWriter_createLastPartRelationships(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkWriter_Create(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			if testing.Short() && n > 100000 {
+				b.Skip("skipping in short mode")
+			}
+			names := benchmarkPartNames(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := NewWriter(ioutil.Discard)
+				for _, name := range names {
+					if _, err := w.Create(name, "image/png"); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func benchmarkPartNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("/tiles/%d/%d.png", i/1000, i%1000)
+	}
+	return names
+}
+
+func BenchmarkWriter_SmallParts(b *testing.B) {
+	for _, compression := range []CompressionOption{CompressionNormal, CompressionFast} {
+		b.Run(fmt.Sprintf("compression%d", compression), func(b *testing.B) {
+			names := benchmarkPartNames(1000)
+			content := []byte(`<?xml version="1.0" encoding="UTF-8"?><a xmlns="http://a.b"><b>c</b></a>`)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := NewWriter(ioutil.Discard)
+				for _, name := range names {
+					pw, err := w.CreatePart(&Part{Name: name, ContentType: "application/xml"}, compression)
+					if err != nil {
+						b.Fatal(err)
+					}
+					pw.Write(content)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package opc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+)
+
+// XMLLimits defines the resources that can be consumed when decoding an XML part.
+// A zero value field means that there is no limit.
+type XMLLimits struct {
+	MaxDepth      int   // Maximum nesting depth of the elements.
+	MaxAttributes int   // Maximum number of attributes of a single element.
+	MaxSize       int64 // Maximum size in bytes of the XML document.
+}
+
+// DefaultXMLLimits are the limits used when decoding the package XML parts.
+var DefaultXMLLimits = XMLLimits{
+	MaxDepth:      256,
+	MaxAttributes: 256,
+	MaxSize:       100 << 20,
+}
+
+// ValidateXML checks that the XML content read from r follows the XML usage rules defined in ISO/IEC 29500-2 §8.1.4
+// and does not exceed the given limits. If limits is nil DefaultXMLLimits is used.
+// The XML content shall be encoded using UTF-8 or UTF-16 and shall not contain DTD declarations.
+// It is useful to screen content parts coming from untrusted sources before processing them.
+func ValidateXML(r io.Reader, limits *XMLLimits) error {
+	if limits == nil {
+		limits = &DefaultXMLLimits
+	}
+	d := newXMLDecoderLimits(r, "", *limits)
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// newXMLDecoder returns a decoder that rejects the XML constructs forbidden by the OPC specs
+// and that enforces DefaultXMLLimits.
+func newXMLDecoder(r io.Reader, partName string) *xml.Decoder {
+	return newXMLDecoderLimits(r, partName, DefaultXMLLimits)
+}
+
+func newXMLDecoderLimits(r io.Reader, partName string, limits XMLLimits) *xml.Decoder {
+	return xml.NewTokenDecoder(newSecureTokenReader(r, partName, limits))
+}
+
+// newSecureTokenReader returns a secureTokenReader reading the raw tokens of r.
+func newSecureTokenReader(r io.Reader, partName string, limits XMLLimits) *secureTokenReader {
+	if limits.MaxSize > 0 {
+		r = &limitedReader{r: r, n: limits.MaxSize, max: limits.MaxSize, partName: partName}
+	}
+	raw := xml.NewDecoder(utf8Reader(r))
+	raw.CharsetReader = charsetReader
+	return &secureTokenReader{d: raw, partName: partName, limits: limits}
+}
+
+// secureTokenReader is a xml.TokenReader that checks the tokens before handling them to the caller.
+type secureTokenReader struct {
+	d        *xml.Decoder
+	partName string
+	limits   XMLLimits
+	depth    int
+}
+
+func (s *secureTokenReader) Token() (xml.Token, error) {
+	t, err := s.d.RawToken()
+	if err != nil {
+		return t, err
+	}
+	switch t1 := t.(type) {
+	case xml.ProcInst:
+		if t1.Target == "xml" && !isUnicodeEncoding(procInstEncoding(t1.Inst)) {
+			// ISO/IEC 29500-2 M1.17
+			return nil, newError(117, s.partName)
+		}
+	case xml.Directive:
+		// ISO/IEC 29500-2 M1.18
+		dir := bytes.ToUpper(bytes.TrimSpace(t1))
+		if bytes.HasPrefix(dir, []byte("DOCTYPE")) || bytes.HasPrefix(dir, []byte("ENTITY")) {
+			return nil, newError(118, s.partName)
+		}
+	case xml.StartElement:
+		s.depth++
+		if s.limits.MaxDepth > 0 && s.depth > s.limits.MaxDepth {
+			return nil, &LimitError{PartName: s.partName, Limit: "XML depth", Value: int64(s.limits.MaxDepth)}
+		}
+		if s.limits.MaxAttributes > 0 && len(t1.Attr) > s.limits.MaxAttributes {
+			return nil, &LimitError{PartName: s.partName, Limit: "XML attributes", Value: int64(s.limits.MaxAttributes)}
+		}
+	case xml.EndElement:
+		s.depth--
+	}
+	return t, nil
+}
+
+// procInstEncoding returns the encoding declared in a XML declaration, if any.
+func procInstEncoding(inst []byte) string {
+	s := string(inst)
+	idx := strings.Index(s, "encoding")
+	if idx < 0 {
+		return ""
+	}
+	s = strings.TrimSpace(s[idx+len("encoding"):])
+	if !strings.HasPrefix(s, "=") {
+		return ""
+	}
+	s = strings.TrimSpace(s[1:])
+	if len(s) == 0 || (s[0] != '\'' && s[0] != '"') {
+		return ""
+	}
+	if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+		return s[1 : end+1]
+	}
+	return ""
+}
+
+func isUnicodeEncoding(enc string) bool {
+	return enc == "" || strings.EqualFold(enc, "UTF-8") || strings.EqualFold(enc, "UTF-16")
+}
+
+// utf8Reader returns a reader that transcodes the content of r to UTF-8
+// if it starts with a UTF-16 byte order mark.
+func utf8Reader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(2)
+	var order binary.ByteOrder
+	switch {
+	case bytes.Equal(bom, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	case bytes.Equal(bom, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	default:
+		return br
+	}
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		return &errReader{err}
+	}
+	u := make([]uint16, (len(b)-2)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2+i*2:])
+	}
+	return strings.NewReader(string(utf16.Decode(u)))
+}
+
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
+
+// charsetReader does not transcode the input, UTF-16 content has already been
+// converted to UTF-8 by utf8Reader and any other encoding is rejected by secureTokenReader.
+func charsetReader(_ string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
+
+// limitedReader reads from r but fails when more than n bytes are read.
+type limitedReader struct {
+	r        io.Reader
+	n, max   int64
+	partName string
+	limit    string // description of the limit, "XML size" if empty
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.err()
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, l.err()
+	}
+	return n, err
+}
+
+func (l *limitedReader) err() error {
+	limit := l.limit
+	if limit == "" {
+		limit = "XML size"
+	}
+	return &LimitError{PartName: l.partName, Limit: limit, Value: l.max}
+}
+
+// decodeError adapts the errors returned while decoding a XML part.
+// Conformance and limit errors are returned unmodified.
+func decodeError(partName string, err error) error {
+	switch err.(type) {
+	case *Error, *LimitError:
+		return err
+	}
+	return fmt.Errorf("opc: %s: cannot be decoded: %v", partName, err)
+}
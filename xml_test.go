@@ -0,0 +1,72 @@
+package opc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateXML(t *testing.T) {
+	billionLaughs := `<?xml version="1.0"?>
+<!DOCTYPE lolz [
+ <!ENTITY lol "lol">
+ <!ENTITY lol2 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+]>
+<lolz>&lol2;</lolz>`
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range `<?xml version="1.0" encoding="UTF-16"?><a b="c"/>` {
+		utf16 = append(utf16, byte(r), 0)
+	}
+	type args struct {
+		content string
+		limits  *XMLLimits
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantCode int
+		wantErr  bool
+	}{
+		{"base", args{`<?xml version="1.0" encoding="UTF-8"?><a><b c="d"/></a>`, nil}, 0, false},
+		{"noDeclaration", args{`<a><b c="d"/></a>`, nil}, 0, false},
+		{"utf16", args{string(utf16), nil}, 0, false},
+		{"doctype", args{billionLaughs, nil}, 118, true},
+		{"doctypeLower", args{`<!doctype a><a/>`, nil}, 118, true},
+		{"latin1", args{`<?xml version="1.0" encoding="ISO-8859-1"?><a/>`, nil}, 117, true},
+		{"malformed", args{`<a><b></a>`, nil}, 0, true},
+		{"depth", args{`<a><b><c/></b></a>`, &XMLLimits{MaxDepth: 2}}, 0, true},
+		{"depthOk", args{`<a><b/><c><d/></c></a>`, &XMLLimits{MaxDepth: 3}}, 0, false},
+		{"attributes", args{`<a b="1" c="2" d="3"/>`, &XMLLimits{MaxAttributes: 2}}, 0, true},
+		{"size", args{`<a>` + strings.Repeat("b", 100) + `</a>`, &XMLLimits{MaxSize: 50}}, 0, true},
+		{"sizeOk", args{`<a>b</a>`, &XMLLimits{MaxSize: 8}}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateXML(bytes.NewBufferString(tt.args.content), tt.args.limits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateXML() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantCode != 0 {
+				if e, ok := err.(*Error); !ok || e.Code() != tt.wantCode {
+					t.Errorf("ValidateXML() error = %v, want code %v", err, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateXML_LimitError(t *testing.T) {
+	err := ValidateXML(bytes.NewBufferString(`<a><b/></a>`), &XMLLimits{MaxDepth: 1})
+	if e, ok := err.(*LimitError); !ok || e.Value != 1 {
+		t.Errorf("ValidateXML() error = %v, want *LimitError", err)
+	}
+}
+
+func Test_decodeRelationships_DTD(t *testing.T) {
+	rels := `<?xml version="1.0"?><!DOCTYPE Relationships [<!ENTITY a "b">]><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`
+	_, err := decodeRelationships(bytes.NewBufferString(rels), "/_rels/.rels")
+	if e, ok := err.(*Error); !ok || e.Code() != 118 || e.PartName() != "/_rels/.rels" {
+		t.Errorf("decodeRelationships() error = %v, want code 118", err)
+	}
+}
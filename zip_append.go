@@ -0,0 +1,247 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	dirHeaderSignature   = "PK\x01\x02"
+	dirHeaderLen         = 46
+	eocd64Signature      = "PK\x06\x06"
+	eocd64Len            = 56
+	uint16max            = 0xFFFF
+	uint32max            = 0xFFFFFFFF
+	zipEOCD64CreatorInfo = zipVersion45
+)
+
+// AppendFile is a file containing a ZIP package which can be modified in place by NewAppendWriter.
+// *os.File implements it.
+type AppendFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// zipDirectory is the location of the central directory of a ZIP archive.
+type zipDirectory struct {
+	offset  int64
+	size    int64
+	records int64
+}
+
+// readZipDirectory locates the central directory using the end of central directory records at the end of r.
+// The offsets stored in the records are relative to base.
+func readZipDirectory(r io.ReaderAt, size, base int64) (zipDirectory, error) {
+	errInvalid := errors.New("opc: invalid zip end of central directory")
+	bufLen := int64(eocdLen + eocd64LocatorLen + maxZipCommentLen)
+	if bufLen > size {
+		bufLen = size
+	}
+	buf := make([]byte, bufLen)
+	if _, err := r.ReadAt(buf, size-bufLen); err != nil && err != io.EOF {
+		return zipDirectory{}, err
+	}
+	p := findEOCD(buf)
+	if p < 0 {
+		return zipDirectory{}, errInvalid
+	}
+	d := zipDirectory{
+		records: int64(binary.LittleEndian.Uint16(buf[p+10:])),
+		size:    int64(binary.LittleEndian.Uint32(buf[p+12:])),
+		offset:  int64(binary.LittleEndian.Uint32(buf[p+16:])),
+	}
+	if l := p - eocd64LocatorLen; l >= 0 && string(buf[l:l+4]) == eocd64LocatorSignature {
+		var rec [eocd64Len]byte
+		off := int64(binary.LittleEndian.Uint64(buf[l+8:])) - base
+		if _, err := r.ReadAt(rec[:], off); err != nil || string(rec[:4]) != eocd64Signature {
+			return zipDirectory{}, errInvalid
+		}
+		d.records = int64(binary.LittleEndian.Uint64(rec[32:]))
+		d.size = int64(binary.LittleEndian.Uint64(rec[40:]))
+		d.offset = int64(binary.LittleEndian.Uint64(rec[48:]))
+	}
+	d.offset -= base
+	if d.offset < 0 || d.size < 0 || d.offset+d.size > size {
+		return zipDirectory{}, errInvalid
+	}
+	return d, nil
+}
+
+// zipDirectoryRecord is a raw central directory file header.
+type zipDirectoryRecord struct {
+	name string
+	raw  []byte
+}
+
+// splitZipDirectory splits the central directory into its file headers.
+func splitZipDirectory(dir []byte) ([]zipDirectoryRecord, error) {
+	var records []zipDirectoryRecord
+	for len(dir) > 0 {
+		if len(dir) < dirHeaderLen || string(dir[:4]) != dirHeaderSignature {
+			return nil, errors.New("opc: invalid zip central directory")
+		}
+		flags := binary.LittleEndian.Uint16(dir[8:])
+		n := int(binary.LittleEndian.Uint16(dir[28:]))
+		m := int(binary.LittleEndian.Uint16(dir[30:]))
+		k := int(binary.LittleEndian.Uint16(dir[32:]))
+		l := dirHeaderLen + n + m + k
+		if len(dir) < l {
+			return nil, errors.New("opc: invalid zip central directory")
+		}
+		name := string(dir[dirHeaderLen : dirHeaderLen+n])
+		if flags&0x800 == 0 && !utf8.ValidString(name) {
+			name = decodeCP437(name)
+		}
+		records = append(records, zipDirectoryRecord{name: name, raw: dir[:l]})
+		dir = dir[l:]
+	}
+	return records, nil
+}
+
+// writeZipDirectory writes the central directory file headers and the end of central directory records,
+// using the Zip64 format if needed, being offset the position of the central directory.
+func writeZipDirectory(w io.Writer, records [][]byte, offset int64) error {
+	var size int64
+	for _, rec := range records {
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+		size += int64(len(rec))
+	}
+	count := int64(len(records))
+	if count >= uint16max || size >= uint32max || offset >= uint32max {
+		var buf [eocd64Len + eocd64LocatorLen]byte
+		b := buf[:]
+		copy(b, eocd64Signature)
+		binary.LittleEndian.PutUint64(b[4:], eocd64Len-12) // size of the remaining record
+		binary.LittleEndian.PutUint16(b[12:], zipEOCD64CreatorInfo)
+		binary.LittleEndian.PutUint16(b[14:], zipEOCD64CreatorInfo)
+		binary.LittleEndian.PutUint64(b[24:], uint64(count))
+		binary.LittleEndian.PutUint64(b[32:], uint64(count))
+		binary.LittleEndian.PutUint64(b[40:], uint64(size))
+		binary.LittleEndian.PutUint64(b[48:], uint64(offset))
+		l := b[eocd64Len:]
+		copy(l, eocd64LocatorSignature)
+		binary.LittleEndian.PutUint64(l[8:], uint64(offset+size))
+		binary.LittleEndian.PutUint32(l[16:], 1)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		count, size, offset = uint16max, uint32max, uint32max
+	}
+	var buf [eocdLen]byte
+	copy(buf[:], eocdSignature)
+	binary.LittleEndian.PutUint16(buf[8:], uint16(count))
+	binary.LittleEndian.PutUint16(buf[10:], uint16(count))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(size))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(offset))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// zipAppender writes new ZIP items in place of the central directory of an existing archive
+// and then writes a central directory containing both the kept and the new items.
+type zipAppender struct {
+	f       AppendFile
+	closer  io.Closer // closed when finished, if not nil
+	size    int64     // size of the original archive
+	dir     zipDirectory
+	tail    []byte // original content from the central directory to the end
+	records []zipDirectoryRecord
+	pos     int64
+	capture *bytes.Buffer // output of zip.Writer.Close
+	written map[string]struct{}
+}
+
+func newZipAppender(f AppendFile, size int64) (*zipAppender, error) {
+	dir, err := readZipDirectory(f, size, 0)
+	if err != nil {
+		return nil, err
+	}
+	tail := make([]byte, size-dir.offset)
+	if _, err = f.ReadAt(tail, dir.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	records, err := splitZipDirectory(tail[:dir.size])
+	if err != nil {
+		return nil, err
+	}
+	return &zipAppender{f: f, size: size, dir: dir, tail: tail, records: records, pos: dir.offset, written: make(map[string]struct{})}, nil
+}
+
+// Write writes the new items after the data of the existing ones.
+func (a *zipAppender) Write(p []byte) (int, error) {
+	if a.capture != nil {
+		return a.capture.Write(p)
+	}
+	n, err := a.f.WriteAt(p, a.pos)
+	a.pos += int64(n)
+	return n, err
+}
+
+// create records that an item is written, so it replaces the existing one.
+func (a *zipAppender) create(name string) {
+	a.written[CanonicalPartName(partNameFromZip(name))] = struct{}{}
+}
+
+// remove drops an existing item from the central directory.
+func (a *zipAppender) remove(partName string) {
+	a.written[CanonicalPartName(partName)] = struct{}{}
+}
+
+// merge finishes zw and writes the central directory with the kept and the new items.
+func (a *zipAppender) merge(zw *zip.Writer) error {
+	start := a.pos
+	a.capture = new(bytes.Buffer)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	out := a.capture.Bytes()
+	a.capture = nil
+	dir, err := readZipDirectory(bytes.NewReader(out), int64(len(out)), start)
+	if err != nil {
+		return err
+	}
+	// The data descriptor of the last item precedes the new central directory
+	if _, err = a.Write(out[:dir.offset]); err != nil {
+		return err
+	}
+	newRecords, err := splitZipDirectory(out[dir.offset : dir.offset+dir.size])
+	if err != nil {
+		return err
+	}
+	records := make([][]byte, 0, len(a.records)+len(newRecords))
+	for _, rec := range a.records {
+		if _, ok := a.written[CanonicalPartName(partNameFromZip(rec.name))]; !ok {
+			records = append(records, rec.raw)
+		}
+	}
+	for _, rec := range newRecords {
+		records = append(records, rec.raw)
+	}
+	if err = writeZipDirectory(a, records, a.pos); err != nil {
+		return err
+	}
+	return a.f.Truncate(a.pos)
+}
+
+// end restores the original archive if failed and closes the file.
+func (a *zipAppender) end(failed bool) error {
+	var err error
+	if failed {
+		if _, err = a.f.WriteAt(a.tail, a.dir.offset); err == nil {
+			err = a.f.Truncate(a.size)
+		}
+	}
+	if a.closer != nil {
+		if cerr := a.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
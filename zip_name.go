@@ -0,0 +1,151 @@
+package opc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// zipName maps a part name to a ZIP item name as described in ISO/IEC 29500-2 §B.3:
+// the part name is converted to an IRI, as specified in RFC 3987 §3.2, and the leading forward slash is removed.
+func zipName(partName string) string {
+	// ISO/IEC 29500-2 M3.4
+	return uriToIRI(strings.TrimPrefix(partName, "/"))
+}
+
+// partNameFromZip maps a ZIP item name to a part name as described in ISO/IEC 29500-2 §B.3:
+// a forward slash is added and the resulting IRI is converted to a URI, as specified in RFC 3987 §3.1.
+func partNameFromZip(zipName string) string {
+	return "/" + iriToURI(zipName)
+}
+
+// isASCII returns true if s only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// iriToURI percent-encodes the UTF-8 octets of all the non-ASCII characters of the IRI.
+func iriToURI(iri string) string {
+	if isASCII(iri) {
+		return iri
+	}
+	var b strings.Builder
+	b.Grow(len(iri) * 2)
+	for i := 0; i < len(iri); i++ {
+		c := iri[i]
+		if c < utf8.RuneSelf {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// uriToIRI percent-decodes the sequences of percent-encoded octets that represent UTF-8 encoded ucschar characters.
+// Percent-encoded ASCII characters and invalid sequences are left untouched.
+func uriToIRI(uri string) string {
+	if !strings.Contains(uri, "%") {
+		return uri
+	}
+	var b strings.Builder
+	b.Grow(len(uri))
+	for i := 0; i < len(uri); {
+		octets, n := percentOctets(uri[i:])
+		if len(octets) == 0 {
+			b.WriteByte(uri[i])
+			i++
+			continue
+		}
+		// Decode the longest valid prefixes, leaving the rest percent-encoded.
+		consumed := 0
+		for consumed < len(octets) {
+			r, size := utf8.DecodeRune(octets[consumed:])
+			if r == utf8.RuneError || !isUcschar(r) {
+				b.WriteString(uri[i+consumed*3 : i+consumed*3+3])
+				consumed++
+				continue
+			}
+			b.WriteRune(r)
+			consumed += size
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// percentOctets returns the non-ASCII octets of the consecutive percent-encoded triplets at the beginning of s
+// and the number of bytes they use in s.
+func percentOctets(s string) ([]byte, int) {
+	var octets []byte
+	n := 0
+	for len(s) >= n+3 && s[n] == '%' && isHex(s[n+1]) && isHex(s[n+2]) {
+		c := unhex(s[n+1])<<4 | unhex(s[n+2])
+		if c < utf8.RuneSelf {
+			break
+		}
+		octets = append(octets, c)
+		n += 3
+	}
+	return octets, n
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// isUcschar reports whether r is a ucschar as defined in RFC 3987 §2.2.
+func isUcschar(r rune) bool {
+	switch {
+	case r >= 0xA0 && r <= 0xD7FF, r >= 0xF900 && r <= 0xFDCF, r >= 0xFDF0 && r <= 0xFFEF:
+		return true
+	case r >= 0x10000 && r <= 0xEFFFD:
+		// Each plane excludes its last two code points.
+		return r&0xFFFE != 0xFFFE
+	}
+	return false
+}
+
+// cp437 maps the high half of the IBM Code Page 437, the default encoding of ZIP item names
+// when the language encoding flag is not set.
+var cp437 = [128]rune{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', ' ',
+}
+
+// decodeCP437 converts a ZIP item name encoded with the IBM Code Page 437 to UTF-8.
+func decodeCP437(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) * 2)
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < utf8.RuneSelf {
+			b.WriteByte(c)
+		} else {
+			b.WriteRune(cp437[c-utf8.RuneSelf])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func Test_zipName(t *testing.T) {
+	tests := []struct {
+		name     string
+		partName string
+		want     string
+	}{
+		{"base", "/docs/a.xml", "docs/a.xml"},
+		{"nonASCII", "/docs/r%C3%A9sum%C3%A9.xml", "docs/résumé.xml"},
+		{"lowerHex", "/docs/r%c3%a9sum%c3%a9.xml", "docs/résumé.xml"},
+		{"asciiEncoded", "/docs/a%20b.xml", "docs/a%20b.xml"},
+		{"invalidUTF8", "/docs/a%C3.xml", "docs/a%C3.xml"},
+		{"notUcschar", "/docs/a%C2%85.xml", "docs/a%C2%85.xml"},
+		{"mixed", "/%E2%82%AC%20%F0%9F%98%80", "€%20😀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zipName(tt.partName); got != tt.want {
+				t.Errorf("zipName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_partNameFromZip(t *testing.T) {
+	tests := []struct {
+		name    string
+		zipName string
+		want    string
+	}{
+		{"base", "docs/a.xml", "/docs/a.xml"},
+		{"nonASCII", "docs/résumé.xml", "/docs/r%C3%A9sum%C3%A9.xml"},
+		{"asciiEncoded", "docs/a%20b.xml", "/docs/a%20b.xml"},
+		{"emoji", "😀.png", "/%F0%9F%98%80.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partNameFromZip(tt.zipName); got != tt.want {
+				t.Errorf("partNameFromZip() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decodeCP437(t *testing.T) {
+	if got := decodeCP437("r\x82sum\x82.xml"); got != "résumé.xml" {
+		t.Errorf("decodeCP437() = %v, want %v", got, "résumé.xml")
+	}
+}
+
+func TestWriter_nonASCIIRoundTrip(t *testing.T) {
+	name := NormalizePartName("/docs/résumé.xml")
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	if _, err := w.Create(name, "text/xml"); err != nil {
+		t.Fatalf("Writer.Create() error = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if zr.File[0].Name != "docs/résumé.xml" || zr.File[0].Flags&0x800 == 0 {
+		t.Errorf("zip item = %v with flags %x, want docs/résumé.xml with language encoding flag", zr.File[0].Name, zr.File[0].Flags)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if got := r.Files[0].Name; got != name {
+		t.Errorf("NewReader() part name = %v, want %v", got, name)
+	}
+}
@@ -2,18 +2,54 @@ package opc
 
 import (
 	"archive/zip"
+	"fmt"
 	"io"
+	"time"
+	"unicode/utf8"
 )
 
 type zipFile struct {
-	f *zip.File
+	f  *zip.File
+	ra io.ReaderAt
 }
 
 func (zf *zipFile) Open() (io.ReadCloser, error) {
 	return zf.f.Open()
 }
 
+func (zf *zipFile) OpenSeeker() (ReadSeekerAt, error) {
+	if zf.f.Method != zip.Store {
+		return nil, fmt.Errorf("opc: %s: cannot be opened for random access: compressed with method %d, a seek index is required", partNameFromZip(zf.Name()), zf.f.Method)
+	}
+	if zf.f.CompressedSize64 != zf.f.UncompressedSize64 {
+		// Otherwise the section would expose the data of the next items
+		return nil, fmt.Errorf("opc: %s: cannot be opened: stored item with different compressed and uncompressed sizes", partNameFromZip(zf.Name()))
+	}
+	offset, err := zf.f.DataOffset()
+	if err != nil {
+		return nil, fmt.Errorf("opc: %s: cannot be opened: %v", partNameFromZip(zf.Name()), err)
+	}
+	return io.NewSectionReader(zf.ra, offset, int64(zf.f.CompressedSize64)), nil
+}
+
+func (zf *zipFile) openDeflated() (*io.SectionReader, uint32, error) {
+	if zf.f.Method != zip.Deflate {
+		return nil, 0, fmt.Errorf("opc: %s: seek index not supported: not deflated", partNameFromZip(zf.Name()))
+	}
+	offset, err := zf.f.DataOffset()
+	if err != nil {
+		return nil, 0, fmt.Errorf("opc: %s: cannot be opened: %v", partNameFromZip(zf.Name()), err)
+	}
+	return io.NewSectionReader(zf.ra, offset, int64(zf.f.CompressedSize64)), zf.f.CRC32, nil
+}
+
+// Name returns the item name encoded in UTF-8.
+// Names that do not have the language encoding flag set are decoded using the IBM Code Page 437,
+// unless they are already valid UTF-8, as many producers do not set the flag.
 func (zf *zipFile) Name() string {
+	if zf.f.NonUTF8 && !utf8.ValidString(zf.f.Name) {
+		return decodeCP437(zf.f.Name)
+	}
 	return zf.f.Name
 }
 
@@ -21,8 +57,17 @@ func (zf *zipFile) Size() int {
 	return int(zf.f.UncompressedSize64)
 }
 
+func (zf *zipFile) CompressedSize() int64 {
+	return int64(zf.f.CompressedSize64)
+}
+
+func (zf *zipFile) ModTime() time.Time {
+	return zf.f.Modified
+}
+
 type zipArchive struct {
-	r *zip.Reader
+	r  *zip.Reader
+	ra io.ReaderAt
 }
 
 func newZipReader(r io.ReaderAt, size int64) (*zipArchive, error) {
@@ -30,14 +75,17 @@ func newZipReader(r io.ReaderAt, size int64) (*zipArchive, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &zipArchive{zr}, nil
+	if err = validateZipArchive(r, size, zr); err != nil {
+		return nil, err
+	}
+	return &zipArchive{zr, r}, nil
 }
 
-func (z *zipArchive) Files() []archiveFile {
+func (z *zipArchive) Files() []ArchiveFile {
 	files := z.r.File
-	ret := make([]archiveFile, len(files))
+	ret := make([]ArchiveFile, len(files))
 	for i := 0; i < len(files); i++ {
-		ret[i] = &zipFile{files[i]}
+		ret[i] = &zipFile{files[i], z.ra}
 	}
 	return ret
 }
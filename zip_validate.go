@@ -0,0 +1,129 @@
+package opc
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+const (
+	zipFlagEncrypted       = 0x1
+	zipFlagStrongEncrypted = 0x40
+	zipFlagMaskedHeaders   = 0x2000
+	zipExtraZip64          = 0x0001
+	zipVersion45           = 45
+	eocdSignature          = "PK\x05\x06"
+	eocdLen                = 22
+	eocd64LocatorSignature = "PK\x06\x07"
+	eocd64LocatorLen       = 20
+	maxZipCommentLen       = 0xFFFF
+)
+
+// validateZipHeader checks that a ZIP item header only uses the features allowed by ISO/IEC 29500-2 Annex C.
+func validateZipHeader(fh *zip.FileHeader, partName string) error {
+	if fh.Flags&(zipFlagEncrypted|zipFlagStrongEncrypted|zipFlagMaskedHeaders) != 0 {
+		return newError(315, partName)
+	}
+	if fh.Method != zip.Store && fh.Method != zip.Deflate {
+		return newError(316, partName)
+	}
+	if hasZip64Extra(fh.Extra) && fh.ReaderVersion&0xFF < zipVersion45 {
+		return newError(318, partName)
+	}
+	return nil
+}
+
+// validateZipArchive checks that the ZIP archive follows the ZIP physical mapping requirements
+// described in ISO/IEC 29500-2 §B and Annex C.
+func validateZipArchive(r io.ReaderAt, size int64, zr *zip.Reader) error {
+	if err := validateZipDisks(r, size); err != nil {
+		return err
+	}
+	names := make(map[string]struct{}, len(zr.File))
+	dirs := make([]string, 0)
+	for _, f := range zr.File {
+		name := (&zipFile{f: f}).Name()
+		partName := partNameFromZip(name)
+		if err := validateZipHeader(&f.FileHeader, partName); err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, "/") {
+			dirs = append(dirs, strings.TrimSuffix(name, "/"))
+			continue
+		}
+		// ISO/IEC 29500-2 M3.3
+		canonical := CanonicalPartName(partName)
+		if _, ok := names[canonical]; ok {
+			return newError(303, partName)
+		}
+		names[canonical] = struct{}{}
+	}
+	for _, d := range dirs {
+		if _, ok := names[CanonicalPartName(partNameFromZip(d))]; ok {
+			return newError(305, partNameFromZip(d))
+		}
+	}
+	return nil
+}
+
+// validateZipDisks checks that the archive does not span multiple disks.
+func validateZipDisks(r io.ReaderAt, size int64) error {
+	bufLen := int64(eocdLen + eocd64LocatorLen + maxZipCommentLen)
+	if bufLen > size {
+		bufLen = size
+	}
+	buf := make([]byte, bufLen)
+	if _, err := r.ReadAt(buf, size-bufLen); err != nil && err != io.EOF {
+		return err
+	}
+	p := findEOCD(buf)
+	if p < 0 {
+		// archive/zip has already validated the archive
+		return nil
+	}
+	disk := binary.LittleEndian.Uint16(buf[p+4:])
+	dirDisk := binary.LittleEndian.Uint16(buf[p+6:])
+	if disk != 0 || dirDisk != 0 {
+		return newError(317, "/")
+	}
+	if l := p - eocd64LocatorLen; l >= 0 && string(buf[l:l+4]) == eocd64LocatorSignature {
+		dirDisk := binary.LittleEndian.Uint32(buf[l+4:])
+		disks := binary.LittleEndian.Uint32(buf[l+16:])
+		if dirDisk != 0 || disks > 1 {
+			return newError(317, "/")
+		}
+	}
+	return nil
+}
+
+// findEOCD returns the position of the end of central directory record in buf, which holds the end of the archive,
+// or -1 if not found. The record is searched backwards and its comment shall end exactly at the end of buf,
+// so a signature inside the archive comment is not taken as the record.
+func findEOCD(buf []byte) int {
+	for p := len(buf) - eocdLen; p >= 0; p-- {
+		if string(buf[p:p+4]) != eocdSignature {
+			continue
+		}
+		if n := int(binary.LittleEndian.Uint16(buf[p+20:])); p+eocdLen+n == len(buf) {
+			return p
+		}
+	}
+	return -1
+}
+
+// hasZip64Extra returns true if the extra field contains the Zip64 extended information.
+func hasZip64Extra(extra []byte) bool {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if tag == zipExtraZip64 {
+			return true
+		}
+		if len(extra) < 4+size {
+			break
+		}
+		extra = extra[4+size:]
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package opc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func buildZip(t *testing.T, headers ...*zip.FileHeader) []byte {
+	t.Helper()
+	return buildZipComment(t, "", headers...)
+}
+
+func buildZipComment(t *testing.T, comment string, headers ...*zip.FileHeader) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	if err := zw.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	zw.RegisterCompressor(12, func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	})
+	fh := &zip.FileHeader{Name: "[Content_Types].xml", Method: zip.Deflate}
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(new(cTypeBuilder).withDefault("application/xml", "xml").String()))
+	for _, fh := range headers {
+		if _, err := zw.CreateHeader(fh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func Test_findEOCD(t *testing.T) {
+	// A multi-disk record inside the comment, whose comment length does not match its position
+	fake := make([]byte, eocdLen)
+	copy(fake, eocdSignature)
+	binary.LittleEndian.PutUint16(fake[4:], 1)
+	binary.LittleEndian.PutUint16(fake[20:], 100)
+	b := buildZipComment(t, string(fake)+"xx", &zip.FileHeader{Name: "a.xml", Method: zip.Deflate})
+	want := len(b) - eocdLen - len(fake) - 2
+	if got := findEOCD(b); got != want {
+		t.Errorf("findEOCD() = %d, want %d", got, want)
+	}
+	if err := validateZipDisks(bytes.NewReader(b), int64(len(b))); err != nil {
+		t.Errorf("validateZipDisks() error = %v", err)
+	}
+	if got := findEOCD(b[:len(b)-1]); got != -1 {
+		t.Errorf("findEOCD() truncated = %d, want -1", got)
+	}
+}
+
+func TestNewReader_ZipConformance(t *testing.T) {
+	multiDisk := buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate})
+	binary.LittleEndian.PutUint16(multiDisk[len(multiDisk)-eocdLen+4:], 1)
+	tests := []struct {
+		name     string
+		content  []byte
+		wantCode int
+	}{
+		{"base", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate}, &zip.FileHeader{Name: "b/", Method: zip.Store}), 0},
+		{"encrypted", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Store, Flags: zipFlagEncrypted}), 315},
+		{"strongEncrypted", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Store, Flags: zipFlagStrongEncrypted}), 315},
+		{"method", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: 12}), 316},
+		{"duplicated", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate}, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate}), 303},
+		{"caseEquivalent", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate}, &zip.FileHeader{Name: "A.XML", Method: zip.Deflate}), 303},
+		{"contentTypesEquivalent", buildZip(t, &zip.FileHeader{Name: "[CONTENT_TYPES].XML", Method: zip.Deflate}), 303},
+		{"folderCollision", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate}, &zip.FileHeader{Name: "A.xml/", Method: zip.Store}), 305},
+		{"zip64Version", buildZip(t, &zip.FileHeader{Name: "a.xml", Method: zip.Deflate, Extra: []byte{1, 0, 0, 0}}), 318},
+		{"multiDisk", multiDisk, 317},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.content), int64(len(tt.content)))
+			checkErrorCode(t, "NewReader()", err, tt.wantCode)
+		})
+	}
+}
+
+func Test_validateZipHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		fh       *zip.FileHeader
+		wantCode int
+	}{
+		{"deflate", &zip.FileHeader{Method: zip.Deflate}, 0},
+		{"store", &zip.FileHeader{Method: zip.Store}, 0},
+		{"maskedHeaders", &zip.FileHeader{Method: zip.Store, Flags: zipFlagMaskedHeaders}, 315},
+		{"method", &zip.FileHeader{Method: 14}, 316},
+		{"zip64", &zip.FileHeader{Method: zip.Deflate, ReaderVersion: zipVersion45, Extra: []byte{1, 0, 0, 0}}, 0},
+		{"zip64Version", &zip.FileHeader{Method: zip.Deflate, ReaderVersion: 20, Extra: []byte{9, 0, 0, 0, 1, 0, 0, 0}}, 318},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkErrorCode(t, "validateZipHeader()", validateZipHeader(tt.fh, "/a.xml"), tt.wantCode)
+		})
+	}
+}
+
+func TestWriter_ZipConformance(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Create("/a.xml", "application/xml")
+	w.Create("/b/c.png", "image/png")
+	w.Relationships = []*Relationship{{Type: "a", TargetURI: "/a.xml"}}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if err := validateZipArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), zr); err != nil {
+		t.Errorf("validateZipArchive() error = %v", err)
+	}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Errorf("zip item %s cannot be read: %v", f.Name, err)
+		}
+	}
+}